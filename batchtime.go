@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// BatchTiming sizes read batches so that each of them takes about Target, like chunk-time of pt-archiver.
+// Zero Target keeps the read batch size fixed.
+type BatchTiming struct {
+	Target  time.Duration
+	MinSize int
+	MaxSize int
+}
+
+func (t BatchTiming) Enabled() bool {
+	return t.Target > 0
+}
+
+func (t BatchTiming) Check() error {
+	if t.Target < 0 {
+		return fmt.Errorf("batch time can not be negative")
+	}
+	if t.MinSize < 1 || t.MaxSize < t.MinSize {
+		return fmt.Errorf("bad read batch bounds %d..%d, minimum must be at least 1 and not above maximum", t.MinSize, t.MaxSize)
+	}
+	return nil
+}
+
+// Clamp keeps batch size within the bounds.
+func (t BatchTiming) Clamp(size int) int {
+	if !t.Enabled() {
+		return size
+	}
+	return min(max(size, t.MinSize), t.MaxSize)
+}
+
+// Next is the size of the batch to read after size rows took the given time. The size
+// grows or shrinks by at most twice per batch, so a single slow or fast batch does not throw
+// it off, and changes of less than a tenth are ignored to keep the prepared statements.
+func (t BatchTiming) Next(current int, size int, took time.Duration) int {
+	if !t.Enabled() {
+		return current
+	}
+	factor := 2.0
+	if took > 0 {
+		factor = min(max(float64(t.Target)/float64(took), 0.5), 2)
+	}
+	next := t.Clamp(int(float64(size) * factor))
+	if diff := next - current; diff*10 > -current && diff*10 < current {
+		return current
+	}
+	return next
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchTimingNext(t *testing.T) {
+	timing := BatchTiming{Target: 500 * time.Millisecond, MinSize: 100, MaxSize: 10000}
+	tests := []struct {
+		name    string
+		current int
+		size    int
+		took    time.Duration
+		want    int
+	}{
+		{"on target", 1000, 1000, 500 * time.Millisecond, 1000},
+		{"close to target", 1000, 1000, 460 * time.Millisecond, 1000},
+		{"twice as slow", 1000, 1000, time.Second, 500},
+		{"way too slow", 1000, 1000, time.Minute, 500},
+		{"way too fast", 1000, 1000, time.Millisecond, 2000},
+		{"instant", 1000, 1000, 0, 2000},
+		{"max bound", 8000, 8000, 100 * time.Millisecond, 10000},
+		{"min bound", 150, 150, 2 * time.Second, 100},
+		{"capped by rate limit", 5000, 200, 250 * time.Millisecond, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := timing.Next(tt.current, tt.size, tt.took); got != tt.want {
+				t.Errorf("Next(%d, %d, %s) = %d, want %d", tt.current, tt.size, tt.took, got, tt.want)
+			}
+		})
+	}
+
+	if got := (BatchTiming{}).Next(1000, 1000, time.Minute); got != 1000 {
+		t.Errorf("disabled Next = %d, want 1000", got)
+	}
+	if got := timing.Clamp(1000000); got != 10000 {
+		t.Errorf("Clamp = %d, want 10000", got)
+	}
+}
+
+func TestBatchTimingCheck(t *testing.T) {
+	for _, timing := range []BatchTiming{
+		{Target: -time.Second, MinSize: 1, MaxSize: 1},
+		{Target: time.Second, MinSize: 0, MaxSize: 10},
+		{Target: time.Second, MinSize: 100, MaxSize: 10},
+	} {
+		if err := timing.Check(); err == nil {
+			t.Errorf("%+v: no error", timing)
+		}
+	}
+	if err := (BatchTiming{Target: time.Second, MinSize: 10, MaxSize: 10}).Check(); err != nil {
+		t.Error(err)
+	}
+}
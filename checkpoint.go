@@ -0,0 +1,237 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const sqliteCreateCheckpointTableQuery = `
+CREATE TABLE IF NOT EXISTS "_arklite_checkpoint" (
+  "table_name" TEXT PRIMARY KEY,
+  "partition_name" TEXT NOT NULL,
+  "where_clauses" TEXT NOT NULL,
+  "id_columns" TEXT NOT NULL,
+  "columns" TEXT NOT NULL,
+  "cursor" TEXT,
+  "rows_copied" INTEGER NOT NULL,
+  "updated_at" TEXT NOT NULL
+)`
+
+const sqliteSelectCheckpointQuery = `
+SELECT "partition_name", "where_clauses", "id_columns", "columns", "cursor", "rows_copied"
+FROM "_arklite_checkpoint"
+WHERE "table_name" = ?`
+
+const sqliteReplaceCheckpointQuery = `
+INSERT OR REPLACE INTO "_arklite_checkpoint" (
+  "table_name", "partition_name", "where_clauses", "id_columns", "columns", "cursor", "rows_copied", "updated_at"
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+const sqliteUpdateCheckpointQuery = `
+UPDATE "_arklite_checkpoint"
+SET "cursor" = ?, "rows_copied" = "rows_copied" + ?, "updated_at" = ?
+WHERE "table_name" = ?`
+
+// Checkpoint is the progress of a copy as stored in the output file,
+// along with everything that has to stay the same for it to be resumed.
+type Checkpoint struct {
+	Table      string
+	Partition  string
+	Where      []string
+	IdColumns  []string
+	Columns    []string
+	Cursor     Cursor
+	RowsCopied uint64
+	// Ranges are set for parallel runs, each with its own cursor
+	Ranges []*ReadRange
+}
+
+func NewCheckpoint(s *Schema) *Checkpoint {
+	columns := make([]string, len(s.Columns))
+	for i, column := range s.Columns {
+		columns[i] = fmt.Sprintf("%s %s", column.name, column.mysqlType)
+		// Values stored in another format can not be mixed with those already copied
+		if column.format != "" {
+			columns[i] += " as " + column.format
+		}
+		if column.location != nil {
+			columns[i] += " in " + column.location.String()
+		}
+	}
+	where := s.Where
+	if where == nil {
+		where = []string{}
+	}
+	return &Checkpoint{
+		Table:     s.Table,
+		Partition: s.Partition,
+		Where:     where,
+		IdColumns: s.IdColumns,
+		Columns:   columns,
+	}
+}
+
+// Verify checks that the checkpoint was made by a run with the same
+// table, filters and columns as the given schema.
+func (cp *Checkpoint) Verify(s *Schema) error {
+	current := NewCheckpoint(s)
+	if cp.Table != current.Table {
+		return fmt.Errorf("checkpoint is for table %s, not %s", cp.Table, current.Table)
+	}
+	if cp.Partition != current.Partition {
+		return fmt.Errorf("--partition does not match the original run: was %q, now %q", cp.Partition, current.Partition)
+	}
+	if !slices.Equal(cp.Where, current.Where) {
+		return fmt.Errorf("--where does not match the original run: was %q, now %q", cp.Where, current.Where)
+	}
+	return cp.VerifyColumns(s)
+}
+
+// VerifyColumns checks that the checkpoint was made by a run with the same
+// id columns and columns as the given schema, whatever rows it copied.
+func (cp *Checkpoint) VerifyColumns(s *Schema) error {
+	current := NewCheckpoint(s)
+	if !slices.Equal(cp.IdColumns, current.IdColumns) {
+		return fmt.Errorf("--id-column does not match the original run: was %q, now %q", cp.IdColumns, current.IdColumns)
+	}
+	if !slices.Equal(cp.Columns, current.Columns) {
+		return fmt.Errorf(
+			"columns do not match the original run: was [%s], now [%s]",
+			strings.Join(cp.Columns, ", "), strings.Join(current.Columns, ", "),
+		)
+	}
+	return nil
+}
+
+func readCheckpoint(db *sql.DB, table string) (*Checkpoint, error) {
+	if _, err := db.Exec(sqliteCreateCheckpointTableQuery); err != nil {
+		return nil, err
+	}
+
+	cp := &Checkpoint{Table: table}
+	var where, idColumns, columns string
+	var cursor sql.NullString
+	err := db.QueryRow(sqliteSelectCheckpointQuery, table).Scan(
+		&cp.Partition, &where, &idColumns, &columns, &cursor, &cp.RowsCopied,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(where), &cp.Where); err != nil {
+		return nil, fmt.Errorf("malformed checkpoint where clauses: %w", err)
+	}
+	if err := json.Unmarshal([]byte(idColumns), &cp.IdColumns); err != nil {
+		return nil, fmt.Errorf("malformed checkpoint id columns: %w", err)
+	}
+	if err := json.Unmarshal([]byte(columns), &cp.Columns); err != nil {
+		return nil, fmt.Errorf("malformed checkpoint columns: %w", err)
+	}
+	if cursor.Valid {
+		cp.Cursor, err = DecodeCursor(cursor.String)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cp.Ranges, err = readRanges(db, table)
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func writeCheckpoint(db *sql.DB, cp *Checkpoint) error {
+	if _, err := db.Exec(sqliteCreateCheckpointTableQuery); err != nil {
+		return err
+	}
+
+	where, err := json.Marshal(cp.Where)
+	if err != nil {
+		return err
+	}
+	idColumns, err := json.Marshal(cp.IdColumns)
+	if err != nil {
+		return err
+	}
+	columns, err := json.Marshal(cp.Columns)
+	if err != nil {
+		return err
+	}
+	var cursor sql.NullString
+	if cp.Cursor != nil {
+		cursor.String, err = cp.Cursor.Encode()
+		if err != nil {
+			return err
+		}
+		cursor.Valid = true
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		sqliteReplaceCheckpointQuery,
+		cp.Table, cp.Partition, string(where), string(idColumns), string(columns),
+		cursor, cp.RowsCopied, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return err
+	}
+	if err := writeRanges(tx, cp.Table, cp.Ranges); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lastCopiedKey is the largest id copied into the table by the run its checkpoint records, as a MySQL
+// key. Ids are compared by MySQL, as SQLite may order them differently, e.g. strings of case-insensitive
+// collations or DECIMAL stored as TEXT. Tables copied before checkpoints were kept fall back to SQLite order.
+func lastCopiedKey(mysqlDb *sql.DB, sqliteDb *sql.DB, s *Schema) (Cursor, error) {
+	checkpoint, err := readCheckpoint(sqliteDb, s.Table)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint == nil {
+		last, err := sqliteIdBound(sqliteDb, s, true)
+		if err != nil {
+			return nil, err
+		}
+		return s.MySQLKey(last)
+	}
+
+	var cursors []Cursor
+	if checkpoint.Cursor != nil {
+		cursors = append(cursors, checkpoint.Cursor)
+	}
+	for _, r := range checkpoint.Ranges {
+		if r.Cursor != nil {
+			cursors = append(cursors, r.Cursor)
+		}
+	}
+	switch len(cursors) {
+	case 0:
+		return nil, nil
+	case 1:
+		return cursors[0], nil
+	}
+
+	var args []any
+	for i, cursor := range cursors {
+		args = append(append(args, i), cursor...)
+	}
+	var last int
+	if err := mysqlDb.QueryRow(s.MySQLLastKeyQuery(len(cursors)), args...).Scan(&last); err != nil {
+		return nil, err
+	}
+	return cursors[last], nil
+}
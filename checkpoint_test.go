@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointVerify(t *testing.T) {
+	original := &Schema{
+		Table:     "orders",
+		Partition: "p_old",
+		Where:     []string{"created_at < '2025-01-01'"},
+		IdColumns: []string{"id"},
+		Columns: []*ColumnInfo{
+			{name: "id", mysqlType: "BIGINT"},
+			{name: "created_at", mysqlType: "DATETIME", format: DatetimeISO},
+		},
+	}
+	checkpoint := NewCheckpoint(original)
+
+	tests := []struct {
+		name    string
+		modify  func(s *Schema)
+		wantErr bool
+	}{
+		{"same run", func(s *Schema) {}, false},
+		{"different table", func(s *Schema) { s.Table = "payments" }, true},
+		{"different partition", func(s *Schema) { s.Partition = "p_modern" }, true},
+		{"no partition", func(s *Schema) { s.Partition = "" }, true},
+		{"different where", func(s *Schema) { s.Where = []string{"created_at < '2024-01-01'"} }, true},
+		{"extra where", func(s *Schema) { s.Where = append(s.Where, "id > 10") }, true},
+		{"no where", func(s *Schema) { s.Where = nil }, true},
+		{"different id column", func(s *Schema) { s.IdColumns = []string{"created_at"} }, true},
+		{"extra id column", func(s *Schema) { s.IdColumns = []string{"id", "created_at"} }, true},
+		{"missing column", func(s *Schema) { s.Columns = s.Columns[:1] }, true},
+		{"changed column type", func(s *Schema) {
+			s.Columns = []*ColumnInfo{
+				{name: "id", mysqlType: "INT"},
+				{name: "created_at", mysqlType: "DATETIME", format: DatetimeISO},
+			}
+		}, true},
+		{"changed column format", func(s *Schema) {
+			s.Columns = []*ColumnInfo{
+				{name: "id", mysqlType: "BIGINT"},
+				{name: "created_at", mysqlType: "DATETIME", format: DatetimeUnix},
+			}
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := *original
+			current.Where = append([]string{}, original.Where...)
+			tt.modify(&current)
+			err := checkpoint.Verify(&current)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSQLiteDSNJournal(t *testing.T) {
+	db, err := sql.Open("sqlite3", sqliteDSN(filepath.Join(t.TempDir(), "out.sqlite"), true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Every connection of the pool has the journal, not only the one the config was executed on
+	ctx := context.Background()
+	for i := range 2 {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		var mode string
+		var synchronous int
+		if err := conn.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&mode); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.QueryRowContext(ctx, "PRAGMA synchronous").Scan(&synchronous); err != nil {
+			t.Fatal(err)
+		}
+		// 2 is FULL
+		if mode != "truncate" || synchronous != 2 {
+			t.Errorf("connection %d journal_mode = %s, synchronous = %d, want truncate and 2", i, mode, synchronous)
+		}
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/spf13/pflag"
+)
+
+// connectionSettings are MySQL connection details from one of the sources, keyed by the names
+// of the flags setting them: user, password, host, port, socket, database and tls-*.
+type connectionSettings map[string]string
+
+// connectionFlags are the flags which override all other sources when they are given.
+var connectionFlags = []string{"user", "password", "host", "port", "socket", "database", "tls-mode", "tls-ca", "tls-cert", "tls-key", "tls-server-name"}
+
+// optionGroups are the groups of MySQL option files arklite reads.
+var optionGroups = []string{"client", "arklite"}
+
+// optionKeys maps keys of MySQL option files to connection settings.
+var optionKeys = map[string]string{
+	"user":     "user",
+	"password": "password",
+	"host":     "host",
+	"port":     "port",
+	"socket":   "socket",
+	"database": "database",
+	"ssl-mode": "tls-mode",
+	"ssl-ca":   "tls-ca",
+	"ssl-cert": "tls-cert",
+	"ssl-key":  "tls-key",
+}
+
+// sslModes maps --ssl-mode of MySQL clients to --tls-mode. MySQL REQUIRED does not verify
+// the server certificate, VERIFY_CA and VERIFY_IDENTITY do.
+var sslModes = map[string]string{
+	"DISABLED":        TLSDisabled,
+	"PREFERRED":       TLSPreferred,
+	"REQUIRED":        TLSSkipVerify,
+	"VERIFY_CA":       TLSRequired,
+	"VERIFY_IDENTITY": TLSRequired,
+}
+
+// mergeSettings merges settings of the sources, later sources override earlier ones.
+func mergeSettings(sources ...connectionSettings) connectionSettings {
+	merged := connectionSettings{}
+	for _, source := range sources {
+		for key, value := range source {
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// envSettings reads the environment variables of MySQL clients.
+func envSettings() connectionSettings {
+	settings := connectionSettings{}
+	for variable, key := range map[string]string{
+		"MYSQL_PWD":       "password",
+		"MYSQL_HOST":      "host",
+		"MYSQL_TCP_PORT":  "port",
+		"MYSQL_UNIX_PORT": "socket",
+	} {
+		if value, ok := os.LookupEnv(variable); ok {
+			settings[key] = value
+		}
+	}
+	return settings
+}
+
+// flagSettings are the connection flags given on the command line.
+func flagSettings(flags *pflag.FlagSet) connectionSettings {
+	settings := connectionSettings{}
+	for _, name := range connectionFlags {
+		if flags.Changed(name) {
+			settings[name] = flags.Lookup(name).Value.String()
+		}
+	}
+	return settings
+}
+
+// dsnSettings parses DSN of the MySQL driver, like user:password@tcp(host:3306)/database.
+// The parsed config keeps the rest of the DSN parameters.
+func dsnSettings(dsn string) (connectionSettings, *mysql.Config, error) {
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	settings := connectionSettings{}
+	if config.User != "" {
+		settings["user"] = config.User
+	}
+	if config.Passwd != "" {
+		settings["password"] = config.Passwd
+	}
+	if config.DBName != "" {
+		settings["database"] = config.DBName
+	}
+	// The address is left to other sources in DSN like user@/database, which the driver fills
+	// with the default address of the network. Networks without a default always have one.
+	if defaults, err := mysql.ParseDSN(config.Net + "/"); err != nil || config.Addr != defaults.Addr {
+		switch config.Net {
+		case "unix":
+			settings["socket"] = config.Addr
+		default:
+			host, port, err := net.SplitHostPort(config.Addr)
+			if err != nil {
+				return nil, nil, err
+			}
+			settings["host"], settings["port"] = host, port
+		}
+	}
+	switch config.TLSConfig {
+	case "":
+	case "true":
+		settings["tls-mode"] = TLSRequired
+	case "false":
+		settings["tls-mode"] = TLSDisabled
+	case TLSSkipVerify, TLSPreferred:
+		settings["tls-mode"] = config.TLSConfig
+	default:
+		return nil, nil, fmt.Errorf("unknown tls %q, use --tls-* flags for custom TLS", config.TLSConfig)
+	}
+	config.TLSConfig, config.TLS = "", nil
+	return settings, config, nil
+}
+
+// readOptionFile reads connection settings of the client and arklite groups of MySQL option file.
+// Like MySQL clients do, later options override earlier ones and world-writable files are ignored.
+func readOptionFile(path string) (connectionSettings, error) {
+	settings := connectionSettings{}
+	return settings, readOptionFileInto(path, settings, 0)
+}
+
+func readOptionFileInto(path string, settings connectionSettings, depth int) error {
+	if depth > 10 {
+		return fmt.Errorf("%s: too many nested includes", path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode().Perm()&0o002 != 0 {
+		slog.Warn("Ignoring world-writable option file", "path", path)
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	inGroup := false
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+
+		case strings.HasPrefix(line, "!include "):
+			if err := readOptionFileInto(includePath(path, line), settings, depth+1); err != nil {
+				return err
+			}
+
+		case strings.HasPrefix(line, "!includedir "):
+			dir := includePath(path, line)
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				if entry.Type().IsRegular() && filepath.Ext(entry.Name()) == ".cnf" {
+					if err := readOptionFileInto(filepath.Join(dir, entry.Name()), settings, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+
+		case line[0] == '[':
+			end := strings.IndexByte(line, ']')
+			if end < 0 {
+				return fmt.Errorf("%s:%d: bad group %s", path, n, line)
+			}
+			inGroup = slices.Contains(optionGroups, strings.ToLower(strings.TrimSpace(line[1:end])))
+
+		case inGroup:
+			name, value, _ := strings.Cut(line, "=")
+			name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), "_", "-")
+			key, ok := optionKeys[name]
+			if !ok {
+				continue
+			}
+			value, err := optionValue(value)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", path, n, err)
+			}
+			if key == "tls-mode" {
+				mode, ok := sslModes[strings.ToUpper(value)]
+				if !ok {
+					return fmt.Errorf("%s:%d: unknown ssl-mode %s", path, n, value)
+				}
+				value = mode
+			}
+			settings[key] = value
+		}
+	}
+	return scanner.Err()
+}
+
+// includePath is the path of !include or !includedir directive, relative to the including file.
+func includePath(path string, line string) string {
+	_, include, _ := strings.Cut(line, " ")
+	include = strings.TrimSpace(include)
+	if !filepath.IsAbs(include) {
+		include = filepath.Join(filepath.Dir(path), include)
+	}
+	return include
+}
+
+// optionValue reads value of option file, optionally quoted, with # comments and
+// escape sequences like \n or \s (space) of MySQL option files.
+func optionValue(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw != "" && (raw[0] == '"' || raw[0] == '\'') {
+		end := strings.IndexByte(raw[1:], raw[0])
+		if end < 0 {
+			return "", fmt.Errorf("unterminated quoted value %s", raw)
+		}
+		return unescapeOption(raw[1 : end+1]), nil
+	}
+	if comment := strings.IndexByte(raw, '#'); comment >= 0 {
+		raw = strings.TrimSpace(raw[:comment])
+	}
+	return unescapeOption(raw), nil
+}
+
+func unescapeOption(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i == len(value)-1 {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 'b':
+			b.WriteByte('\b')
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 's':
+			b.WriteByte(' ')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			// Unknown sequences are kept, e.g. in Windows paths
+			b.WriteByte('\\')
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// defaultOptionFile is ~/.my.cnf, read unless --defaults-file or --no-defaults is given.
+func defaultOptionFile() (connectionSettings, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, nil
+	}
+	settings, err := readOptionFile(filepath.Join(home, ".my.cnf"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return settings, err
+}
+
+// mysqlConfig turns merged settings into the config of MySQL driver, on top of base parsed from --dsn.
+// Socket is connected to when it is set and the host is localhost, like MySQL clients do.
+func (s connectionSettings) mysqlConfig(base *mysql.Config) (*mysql.Config, error) {
+	config := base
+	if config == nil {
+		config = mysql.NewConfig()
+	}
+	config.User = s["user"]
+	config.Passwd = s["password"]
+	config.DBName = s["database"]
+	config.AllowNativePasswords = true
+
+	host := s["host"]
+	if host == "" {
+		host = "localhost"
+	}
+	port := 3306
+	if s["port"] != "" {
+		var err error
+		if port, err = strconv.Atoi(s["port"]); err != nil || port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("bad port %q", s["port"])
+		}
+	}
+	if s["socket"] != "" && host == "localhost" {
+		config.Net = "unix"
+		config.Addr = s["socket"]
+	} else {
+		config.Net = "tcp"
+		config.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	// Temporal values are parsed by TypeMapping, so --dsn can not turn on parseTime
+	config.ParseTime = false
+	config.Loc = time.UTC
+	return config, nil
+}
+
+// utcSession is the config with UTC session time zone, so that TIMESTAMP values are read and written in UTC.
+// It also makes NOW() and CURDATE() return UTC, so it is used only when TIMESTAMP columns are copied.
+func utcSession(config *mysql.Config) *mysql.Config {
+	utc := config.Clone()
+	if utc.Params == nil {
+		utc.Params = map[string]string{}
+	}
+	utc.Params["time_zone"] = "'+00:00'"
+	return utc
+}
+
+// tlsOptions are the TLS settings, checked with TLSOptions.Check. Disabled TLS drops
+// certificates, e.g. of option file, so that --tls-mode disabled overrides them.
+func (s connectionSettings) tlsOptions() TLSOptions {
+	if s["tls-mode"] == TLSDisabled {
+		return TLSOptions{Mode: TLSDisabled}
+	}
+	return TLSOptions{Mode: s["tls-mode"], CA: s["tls-ca"], Cert: s["tls-cert"], Key: s["tls-key"], ServerName: s["tls-server-name"]}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestReadOptionFile(t *testing.T) {
+	dir := t.TempDir()
+	cnf := filepath.Join(dir, "my.cnf")
+	writeFile := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(cnf, `# connection of the archiver
+[mysqld]
+port = 3307
+
+[client]
+user = archiver
+password = "s3cret #1"   # quoted to keep the hash
+host=db1
+ssl_mode = VERIFY_IDENTITY
+ssl-ca = /etc/ssl/mysql ca.pem
+!include extra.cnf
+
+[mysqldump]
+user = dumper
+
+[arklite]
+socket = /run/mysqld/mysqld.sock
+`)
+	writeFile(filepath.Join(dir, "extra.cnf"), "[client]\nhost = db2\ndatabase = 'shop'\n")
+
+	got, err := readOptionFile(cnf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := connectionSettings{
+		"user":     "archiver",
+		"password": "s3cret #1",
+		"host":     "db2",
+		"database": "shop",
+		"socket":   "/run/mysqld/mysqld.sock",
+		"tls-mode": TLSRequired,
+		"tls-ca":   "/etc/ssl/mysql ca.pem",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readOptionFile() = %v, want %v", got, want)
+	}
+
+	writeFile(cnf, "[client]\nssl-mode = sometimes\n")
+	if _, err := readOptionFile(cnf); err == nil {
+		t.Error("unknown ssl-mode, want error")
+	}
+
+	writeFile(cnf, "[client]\nuser = writable\n")
+	if err := os.Chmod(cnf, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readOptionFile(cnf); err != nil || len(got) != 0 {
+		t.Errorf("world-writable file read as %v, %v", got, err)
+	}
+}
+
+func TestOptionValue(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{" plain ", "plain", false},
+		{"value # comment", "value", false},
+		{`"quoted # not a comment"`, "quoted # not a comment", false},
+		{`'single' # comment`, "single", false},
+		{`pass\sword\\`, `pass word\`, false},
+		{`C:\mysql\certs`, `C:\mysql\certs`, false},
+		{"", "", false},
+		{`"unterminated`, "", true},
+	}
+	for _, tt := range tests {
+		got, err := optionValue(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("optionValue(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("optionValue(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestDSNSettings(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		want    connectionSettings
+		wantErr bool
+	}{
+		{"archiver:secret@tcp(db1:3307)/shop?tls=skip-verify", connectionSettings{"user": "archiver", "password": "secret", "host": "db1", "port": "3307", "database": "shop", "tls-mode": TLSSkipVerify}, false},
+		{"archiver@unix(/run/mysqld/mysqld.sock)/shop", connectionSettings{"user": "archiver", "socket": "/run/mysqld/mysqld.sock", "database": "shop"}, false},
+		{"archiver@/shop?tls=true", connectionSettings{"user": "archiver", "database": "shop", "tls-mode": TLSRequired}, false},
+		{"archiver@tcp(db1)/shop?loc=Europe%2FBerlin", connectionSettings{"user": "archiver", "host": "db1", "port": "3306", "database": "shop"}, false},
+		{"archiver:pass/word@/shop?loc=Europe%2FBerlin", connectionSettings{"user": "archiver", "password": "pass/word", "database": "shop"}, false},
+		{"archiver@tcp(db1:3306)/shop?tls=custom", nil, true},
+		{"db1:3306", nil, true},
+	}
+	for _, tt := range tests {
+		got, config, err := dsnSettings(tt.dsn)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("dsnSettings(%q) error = %v, wantErr %v", tt.dsn, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("dsnSettings(%q) = %v, want %v", tt.dsn, got, tt.want)
+		}
+		if config.TLSConfig != "" {
+			t.Errorf("dsnSettings(%q) kept tls %q", tt.dsn, config.TLSConfig)
+		}
+	}
+
+	_, base, err := dsnSettings("archiver@tcp(db1:3306)/shop?parseTime=true&loc=Local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := connectionSettings{}.mysqlConfig(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ParseTime || config.Loc != time.UTC {
+		t.Errorf("parseTime=true in DSN gives ParseTime %v and Loc %s, want false and UTC", config.ParseTime, config.Loc)
+	}
+}
+
+func TestConnectionSettings(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringP("host", "H", "localhost", "")
+	flags.IntP("port", "P", 3306, "")
+	for _, name := range connectionFlags {
+		if flags.Lookup(name) == nil {
+			flags.String(name, "", "")
+		}
+	}
+	if err := flags.Parse([]string{"-P", "3310", "--user", "cli"}); err != nil {
+		t.Fatal(err)
+	}
+
+	env := connectionSettings{"password": "from-env", "host": "env-host"}
+	file := connectionSettings{"user": "file-user", "host": "file-host", "database": "shop"}
+	dsn := connectionSettings{"host": "dsn-host"}
+	got := mergeSettings(env, file, dsn, flagSettings(flags))
+	want := connectionSettings{"user": "cli", "password": "from-env", "host": "dsn-host", "port": "3310", "database": "shop"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged settings = %v, want %v", got, want)
+	}
+
+	tests := []struct {
+		settings connectionSettings
+		wantNet  string
+		wantAddr string
+		wantErr  bool
+	}{
+		{connectionSettings{}, "tcp", "localhost:3306", false},
+		{connectionSettings{"host": "db1", "port": "3307"}, "tcp", "db1:3307", false},
+		{connectionSettings{"socket": "/tmp/mysql.sock"}, "unix", "/tmp/mysql.sock", false},
+		{connectionSettings{"host": "localhost", "socket": "/tmp/mysql.sock"}, "unix", "/tmp/mysql.sock", false},
+		{connectionSettings{"host": "127.0.0.1", "socket": "/tmp/mysql.sock"}, "tcp", "127.0.0.1:3306", false},
+		{connectionSettings{"host": "::1"}, "tcp", "[::1]:3306", false},
+		{connectionSettings{"port": "mysql"}, "", "", true},
+	}
+	for _, tt := range tests {
+		config, err := tt.settings.mysqlConfig(nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: error = %v, wantErr %v", tt.settings, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if config.Net != tt.wantNet || config.Addr != tt.wantAddr {
+			t.Errorf("%v: connects to %s(%s), want %s(%s)", tt.settings, config.Net, config.Addr, tt.wantNet, tt.wantAddr)
+		}
+		if zone, ok := config.Params["time_zone"]; ok {
+			t.Errorf("%v: time_zone = %q, want the server default", tt.settings, zone)
+		}
+	}
+
+	config, err := connectionSettings{"host": "db1"}.mysqlConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utc := utcSession(config); utc.Params["time_zone"] != "'+00:00'" || utc.Addr != config.Addr {
+		t.Errorf("utcSession() time_zone = %q, addr %s", utc.Params["time_zone"], utc.Addr)
+	}
+	if _, ok := config.Params["time_zone"]; ok {
+		t.Error("utcSession() changed the config it was given")
+	}
+
+	if opts := (connectionSettings{"tls-mode": TLSDisabled, "tls-ca": "ca.pem"}).tlsOptions(); opts.CA != "" {
+		t.Errorf("disabled TLS kept CA %s", opts.CA)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// CheckInfo is a CHECK constraint of MySQL table.
+type CheckInfo struct {
+	name   string
+	clause string
+}
+
+// Functions which work the same way in MySQL and SQLite
+var sqliteCheckFunctions = []string{"abs", "coalesce", "ifnull", "lower", "nullif", "upper"}
+
+var sqliteCheckKeywords = []string{"and", "between", "false", "in", "is", "like", "not", "null", "or", "true"}
+
+func fetchChecks(db *sql.DB, table string) ([]*CheckInfo, error) {
+	rows, err := db.Query(`
+SELECT tc.CONSTRAINT_NAME, cc.CHECK_CLAUSE
+FROM information_schema.TABLE_CONSTRAINTS tc
+JOIN information_schema.CHECK_CONSTRAINTS cc
+  ON cc.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND cc.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+WHERE tc.TABLE_SCHEMA = DATABASE() AND tc.TABLE_NAME = ? AND tc.CONSTRAINT_TYPE = 'CHECK' AND tc.ENFORCED = 'YES'
+ORDER BY tc.CONSTRAINT_NAME`, table)
+	// MySQL before 8.0.16 has no CHECK constraints
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && (mysqlErr.Number == 1109 || mysqlErr.Number == 1054) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checks []*CheckInfo
+	for rows.Next() {
+		check := &CheckInfo{}
+		if err := rows.Scan(&check.name, &check.clause); err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return checks, rows.Err()
+}
+
+// SQLiteUntranslated lists constraints of the MySQL table which can not be
+// expressed in SQLite and are kept as comments in the SQLite schema only.
+func (s *Schema) SQLiteUntranslated() []string {
+	var untranslated []string
+	for _, column := range s.Columns {
+		_, notes := column.sqliteConstraints()
+		for _, note := range notes {
+			untranslated = append(untranslated, fmt.Sprintf("column %s: %s", column.name, note))
+		}
+	}
+	for _, check := range s.Checks {
+		if _, err := check.sqliteClause(s); err != nil {
+			untranslated = append(untranslated, fmt.Sprintf("check %s %s: %s", check.name, check.clause, err))
+		}
+	}
+	return untranslated
+}
+
+// sqliteConstraints translates NOT NULL and DEFAULT of the column into SQLite,
+// returning what can not be translated as notes.
+func (c *ColumnInfo) sqliteConstraints() (string, []string) {
+	var constraints []string
+	var notes []string
+
+	// Zero dates are stored as NULL by default, see --zero-date
+	if !c.nullable && !(c.temporal() && c.zeroDate == ZeroDateNull) {
+		constraints = append(constraints, "NOT NULL")
+	}
+
+	if c.generated != "" {
+		notes = append(notes, fmt.Sprintf("generated as (%s), stored as a plain column", c.generated))
+	} else if c.defaultValue.Valid {
+		literal, err := c.sqliteDefault(c.defaultValue.String)
+		if err != nil {
+			notes = append(notes, fmt.Sprintf("DEFAULT %s: %s", c.defaultValue.String, err))
+		} else {
+			constraints = append(constraints, "DEFAULT "+literal)
+		}
+	}
+
+	if strings.Contains(strings.ToLower(c.extra), "on update") {
+		notes = append(notes, c.extra)
+	}
+	return strings.Join(constraints, " "), notes
+}
+
+// sqliteDefault translates MySQL column default as information_schema shows
+// it into SQLite literal or expression, stored in the same format as the values are.
+func (c *ColumnInfo) sqliteDefault(value string) (string, error) {
+	upper := strings.ToUpper(value)
+	if c.temporal() && (strings.HasPrefix(upper, "CURRENT_TIMESTAMP") || strings.HasPrefix(upper, "NOW(")) {
+		return c.sqliteNow()
+	}
+	if strings.Contains(c.extra, "DEFAULT_GENERATED") {
+		return "", errors.New("expression defaults are not supported")
+	}
+
+	var converted any = value
+	var err error
+	switch {
+	case c.temporal() && c.format != "":
+		converted, err = c.temporalValue(value)
+	case c.dataType == "decimal" && c.format == DecimalInteger:
+		converted, err = scaleDecimal(value, c.scale)
+	case c.unsigned64() && c.format != "":
+		var unsigned uint64
+		unsigned, err = strconv.ParseUint(value, 10, 64)
+		if err == nil {
+			converted, err = unsignedValue(unsigned, c.format, c.name)
+		}
+	case c.sqliteType == "INTEGER" || c.sqliteType == "REAL":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return "", errors.New("not a number")
+		}
+		return value, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	switch v := converted.(type) {
+	case nil:
+		return "NULL", nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []byte:
+		return fmt.Sprintf("X'%X'", v), nil
+	case string:
+		if c.sqliteType == "BLOB" {
+			return fmt.Sprintf("X'%X'", v), nil
+		}
+		return sqliteString(v), nil
+	default:
+		return "", fmt.Errorf("unexpected value of type %T", converted)
+	}
+}
+
+// sqliteNow is the SQLite expression for current time in the storage format of the column.
+func (c *ColumnInfo) sqliteNow() (string, error) {
+	modifier := ""
+	if c.dataType == "date" {
+		modifier = ", 'start of day'"
+	}
+	switch c.format {
+	case DatetimeUnix:
+		return fmt.Sprintf("(CAST(strftime('%%s', 'now'%s) AS INTEGER))", modifier), nil
+	case DatetimeJulian:
+		return fmt.Sprintf("(julianday('now'%s))", modifier), nil
+	}
+	if c.location != nil {
+		return "", errors.New("current time is in UTC in SQLite, not in --datetime-tz")
+	}
+	if c.dataType == "date" {
+		return "CURRENT_DATE", nil
+	}
+	return "CURRENT_TIMESTAMP", nil
+}
+
+// sqliteClause translates MySQL CHECK clause into SQLite one. Only comparisons
+// of columns stored as they are with literals and a few common functions are supported.
+func (ch *CheckInfo) sqliteClause(s *Schema) (string, error) {
+	var out strings.Builder
+	clause := ch.clause
+	for i := 0; i < len(clause); {
+		r := rune(clause[i])
+		switch {
+		case unicode.IsSpace(r):
+			out.WriteByte(' ')
+			i++
+
+		case r == '`':
+			end := strings.IndexByte(clause[i+1:], '`')
+			if end < 0 {
+				return "", errors.New("unterminated identifier")
+			}
+			column, err := checkColumn(s, clause[i+1:i+1+end])
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(column)
+			i += end + 2
+
+		case r == '\'':
+			literal, n, err := mysqlString(clause[i:])
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(sqliteString(literal))
+			i += n
+
+		case r >= '0' && r <= '9' || r == '.':
+			j := i
+			for j < len(clause) && (clause[j] >= '0' && clause[j] <= '9' || clause[j] == '.') {
+				j++
+			}
+			out.WriteString(clause[i:j])
+			i = j
+
+		case r == '_' || unicode.IsLetter(r):
+			j := i
+			for j < len(clause) && (clause[j] == '_' || clause[j] == '$' || unicode.IsLetter(rune(clause[j])) || unicode.IsDigit(rune(clause[j]))) {
+				j++
+			}
+			word := clause[i:j]
+			lower := strings.ToLower(word)
+			switch {
+			case strings.HasPrefix(word, "_") && j < len(clause) && clause[j] == '\'':
+				// Character set introducer like _utf8mb4'text'
+			case slices.Contains(sqliteCheckKeywords, lower):
+				out.WriteString(strings.ToUpper(word))
+			case j < len(clause) && clause[j] == '(':
+				if !slices.Contains(sqliteCheckFunctions, lower) {
+					return "", fmt.Errorf("function %s is not supported", word)
+				}
+				out.WriteString(lower)
+			default:
+				column, err := checkColumn(s, word)
+				if err != nil {
+					return "", err
+				}
+				out.WriteString(column)
+			}
+			i = j
+
+		default:
+			operator := ""
+			for _, op := range []string{"<=>", "<>", "!=", "<=", ">=", "(", ")", ",", "+", "-", "*", "/", "%", "=", "<", ">"} {
+				if strings.HasPrefix(clause[i:], op) {
+					operator = op
+					break
+				}
+			}
+			if operator == "" || operator == "<=>" {
+				return "", fmt.Errorf("unsupported %q", clause[i:])
+			}
+			out.WriteString(operator)
+			i += len(operator)
+		}
+	}
+	return out.String(), nil
+}
+
+// checkColumn quotes column used in CHECK clause, if its values are stored as they are in MySQL.
+func checkColumn(s *Schema, name string) (string, error) {
+	index := s.ColumnIndex(name)
+	if index < 0 {
+		return "", fmt.Errorf("column %s is not copied", name)
+	}
+	column := s.Columns[index]
+	asIs := column.format == "" ||
+		column.unsigned64() && column.format == UnsignedInteger ||
+		column.temporal() && column.format == DatetimeISO && column.location == nil
+	if !asIs {
+		return "", fmt.Errorf("column %s is stored as %s", name, strings.ToLower(column.sqliteType))
+	}
+	return quoteSQLite(name), nil
+}
+
+// mysqlString reads string literal at the start of the value, returning it unquoted along with its length.
+func mysqlString(value string) (string, int, error) {
+	var literal strings.Builder
+	for i := 1; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			if i+1 < len(value) && value[i+1] == '\'' {
+				literal.WriteByte('\'')
+				i++
+				continue
+			}
+			return "", 0, errors.New("escape sequences are not supported")
+		case '\'':
+			if i+1 < len(value) && value[i+1] == '\'' {
+				literal.WriteByte('\'')
+				i++
+				continue
+			}
+			return literal.String(), i + 1, nil
+		default:
+			literal.WriteByte(value[i])
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
+
+func sqliteString(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
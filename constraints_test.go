@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSqliteConstraints(t *testing.T) {
+	value := func(v string) sql.NullString { return sql.NullString{String: v, Valid: true} }
+
+	tests := []struct {
+		name      string
+		column    ColumnInfo
+		want      string
+		wantNotes int
+	}{
+		{"nullable", ColumnInfo{nullable: true, sqliteType: "TEXT"}, "", 0},
+		{"not null", ColumnInfo{sqliteType: "TEXT"}, "NOT NULL", 0},
+		{"string default", ColumnInfo{nullable: true, sqliteType: "TEXT", defaultValue: value("it's")}, "DEFAULT 'it''s'", 0},
+		{"number default", ColumnInfo{sqliteType: "INTEGER", defaultValue: value("0")}, "NOT NULL DEFAULT 0", 0},
+		{"bad number default", ColumnInfo{nullable: true, sqliteType: "INTEGER", defaultValue: value("b'1'")}, "", 1},
+		{
+			"decimal default",
+			ColumnInfo{nullable: true, dataType: "decimal", scale: 2, format: DecimalInteger, sqliteType: "INTEGER", defaultValue: value("1.50")},
+			"DEFAULT 150", 0,
+		},
+		{
+			"unsigned default",
+			ColumnInfo{nullable: true, dataType: "bigint", columnType: "bigint unsigned", format: UnsignedText, sqliteType: "TEXT", defaultValue: value("7")},
+			"DEFAULT '00000000000000000007'", 0,
+		},
+		{
+			"current timestamp",
+			ColumnInfo{dataType: "timestamp", format: DatetimeISO, sqliteType: "TEXT", defaultValue: value("CURRENT_TIMESTAMP"), extra: "DEFAULT_GENERATED"},
+			"NOT NULL DEFAULT CURRENT_TIMESTAMP", 0,
+		},
+		{
+			"current timestamp as unix",
+			ColumnInfo{nullable: true, dataType: "datetime", format: DatetimeUnix, sqliteType: "INTEGER", defaultValue: value("CURRENT_TIMESTAMP(6)")},
+			"DEFAULT (CAST(strftime('%s', 'now') AS INTEGER))", 0,
+		},
+		{
+			"on update",
+			ColumnInfo{nullable: true, dataType: "datetime", format: DatetimeISO, sqliteType: "TEXT", defaultValue: value("CURRENT_TIMESTAMP"), extra: "DEFAULT_GENERATED on update CURRENT_TIMESTAMP"},
+			"DEFAULT CURRENT_TIMESTAMP", 1,
+		},
+		{
+			"zero date not null",
+			ColumnInfo{dataType: "date", format: DatetimeISO, zeroDate: ZeroDateNull, sqliteType: "TEXT", defaultValue: value("0000-00-00")},
+			"DEFAULT NULL", 0,
+		},
+		{"expression default", ColumnInfo{nullable: true, sqliteType: "TEXT", defaultValue: value("uuid()"), extra: "DEFAULT_GENERATED"}, "", 1},
+		{"generated", ColumnInfo{nullable: true, sqliteType: "INTEGER", generated: "`qty` * 2", extra: "STORED GENERATED"}, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, notes := tt.column.sqliteConstraints()
+			if got != tt.want {
+				t.Errorf("sqliteConstraints() = %q, want %q", got, tt.want)
+			}
+			if len(notes) != tt.wantNotes {
+				t.Errorf("sqliteConstraints() notes = %q, want %d of them", notes, tt.wantNotes)
+			}
+		})
+	}
+}
+
+func TestSqliteCheckClause(t *testing.T) {
+	s := &Schema{
+		Columns: []*ColumnInfo{
+			{name: "qty", sqliteType: "INTEGER"},
+			{name: "status", sqliteType: "TEXT"},
+			{name: "price", dataType: "decimal", format: DecimalText, sqliteType: "TEXT"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		clause  string
+		want    string
+		wantErr bool
+	}{
+		{"comparison", "(`qty` >= 0)", `("qty" >= 0)`, false},
+		{"bare column", "(qty >= 0)", `("qty" >= 0)`, false},
+		{"introducer", "(`status` in (_utf8mb4'new',_utf8mb4'it\\'s'))", `("status" IN ('new','it''s'))`, false},
+		{"logic", "((`qty` < 10) and (not((`status` = _utf8mb4'x'))))", `(("qty" < 10) AND (NOT(("status" = 'x'))))`, false},
+		{"function", "(lower(`status`) <> _utf8mb4'x')", `(lower("status") <> 'x')`, false},
+		{"unsupported function", "(char_length(`status`) < 15)", "", true},
+		{"decimal as text", "(`price` > 0)", "", true},
+		{"unknown column", "(`secret` > 0)", "", true},
+		{"null safe equal", "(`qty` <=> 1)", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := (&CheckInfo{name: "chk", clause: tt.clause}).sqliteClause(s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("sqliteClause() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("sqliteClause() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
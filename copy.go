@@ -2,10 +2,12 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
-	"reflect"
+	"math"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dustin/go-humanize"
@@ -14,11 +16,33 @@ import (
 
 type RowData []any
 
+// copiedRow is a row read by one of the readers, rangeIndex tells which of Copier.ranges it is from.
+type copiedRow struct {
+	rangeIndex int
+	row        RowData
+}
+
 type CopierOptions struct {
 	WriteBatchSize int
 	ReadBatchSize  int
 	Limit          uint64
-	Progress       ProgressRenderer
+	Resume         bool
+	Append         bool
+	Purge          bool
+	PurgeChunkSize int
+	PurgeSleep     time.Duration
+	Parallel       int
+	// Shards split the output into several files instead of the single sqliteDb
+	Shards *ShardOptions
+	// Writer stores the rows instead of SQLite, sqliteDb is not used then
+	Writer BatchWriter
+	// Throttler pauses reads and purges while MySQL is busy, nil when not throttling
+	Throttler *Throttler
+	// RateLimit caps rows and bytes read from MySQL per second
+	RateLimit RateLimit
+	// BatchTiming adapts the read batch size to how long batches take, starting from ReadBatchSize
+	BatchTiming BatchTiming
+	Progress    ProgressRenderer
 }
 
 type Copier struct {
@@ -27,6 +51,21 @@ type Copier struct {
 	opts     CopierOptions
 	schema   *Schema
 	wg       sync.WaitGroup
+
+	// ranges are read in parallel when there are more than one of them,
+	// otherwise the whole table is read as one range
+	ranges   []*ReadRange
+	parallel bool
+	rowsRead atomic.Uint64
+	stopped  atomic.Bool
+	writeErr error
+	limiter  *rateLimiter
+	// appendedAfter is the largest id archived before an append, as a MySQL key
+	appendedAfter Cursor
+	shards        *shardSet
+
+	rowsWritten uint64
+	rowsPurged  uint64
 }
 
 func NewCopier(mysqlDb *sql.DB, sqliteDb *sql.DB, schema *Schema, opts CopierOptions) *Copier {
@@ -40,135 +79,365 @@ func NewCopier(mysqlDb *sql.DB, sqliteDb *sql.DB, schema *Schema, opts CopierOpt
 }
 
 func (c *Copier) CreateTable() error {
+	if c.opts.Append {
+		if err := c.checkAppend(); err != nil {
+			return fmt.Errorf("can not append: %w", err)
+		}
+	}
 	slog.Info("Creating SQLite table", "table", c.schema.Table)
-	query := c.schema.SQLiteCreateTableQuery()
+	if err := createSQLiteTable(c.sqliteDb, c.schema); err != nil {
+		return err
+	}
+	slog.Info("SQLite table created successfully", "table", c.schema.Table)
+	return nil
+}
+
+func createSQLiteTable(db *sql.DB, s *Schema) error {
+	query := s.SQLiteCreateTableQuery()
 	slog.Debug("SQLite create table query")
 	slog.Debug(query)
-	_, err := c.sqliteDb.Exec(query)
+	_, err := db.Exec(query)
 	if err != nil {
 		return err
 	}
-	slog.Info("SQLite table created successfully", "table", c.schema.Table)
+	if query := s.SQLiteCreateIdIndexQuery(); query != "" {
+		slog.Debug(query)
+		if _, err := db.Exec(query); err != nil {
+			return err
+		}
+	}
+	return writeColumnsMetadata(db, s)
+}
+
+// CreateIndexes recreates secondary indexes of the MySQL table once the data is loaded.
+func (c *Copier) CreateIndexes() error {
+	return createSQLiteIndexes(c.sqliteDb, c.schema)
+}
+
+func createSQLiteIndexes(db *sql.DB, s *Schema) error {
+	for _, index := range s.SQLiteIndexes() {
+		slog.Info("Creating SQLite index", "table", s.Table, "index", index.name)
+		query := s.SQLiteCreateIndexQuery(index)
+		slog.Debug(query)
+		if _, err := db.Exec(query); err != nil {
+			return fmt.Errorf("creating index %s: %w", index.name, err)
+		}
+	}
+	return nil
+}
+
+// InitCheckpoint records the new run in the output file or, when resuming,
+// picks up the cursor of the last committed batch from the checkpoint of the previous one.
+func (c *Copier) InitCheckpoint() error {
+	if c.opts.Writer != nil {
+		// Other formats are not resumed, there is nothing to record
+		return c.planReadRanges(nil)
+	}
+	if c.opts.Shards != nil {
+		// Every shard gets its checkpoint when it is created
+		var err error
+		if c.shards, err = newShardSet(*c.opts.Shards, c.schema); err != nil {
+			return err
+		}
+		c.shards.purge = c.opts.Purge
+		return c.planReadRanges(nil)
+	}
+
+	checkpoint, err := readCheckpoint(c.sqliteDb, c.schema.Table)
+	if err != nil {
+		return err
+	}
+
+	if c.opts.Append || c.opts.Resume {
+		// Rows of the last batch of an interrupted run may be committed to SQLite but not purged
+		if err := c.purgePending(); err != nil {
+			return err
+		}
+	}
+
+	if c.opts.Append {
+		return c.appendCheckpoint(checkpoint)
+	}
+	if !c.opts.Resume {
+		return c.startCheckpoint(nil, 0)
+	}
+
+	if checkpoint == nil {
+		// Table was not reached by the interrupted run, nothing to resume
+		empty, err := c.tableEmpty()
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return fmt.Errorf("no checkpoint found for table %s, can not resume", c.schema.Table)
+		}
+		slog.Info("No checkpoint found, starting from the beginning", "table", c.schema.Table)
+		return c.startCheckpoint(nil, 0)
+	}
+	if err := checkpoint.Verify(c.schema); err != nil {
+		return fmt.Errorf("can not resume: %w", err)
+	}
+
+	if len(checkpoint.Ranges) > 0 {
+		// Ranges can not be planned again, MIN/MAX have changed since
+		c.ranges = checkpoint.Ranges
+		c.parallel = true
+		if c.opts.Parallel != len(c.ranges) {
+			slog.Info("Resuming with ranges of the original run", "table", c.schema.Table, "ranges", len(c.ranges))
+		}
+		for i, r := range c.ranges {
+			slog.Info(
+				"Resuming range from checkpoint",
+				"table", c.schema.Table,
+				"range", r,
+				"range_index", i,
+				"cursor", r.Cursor,
+				"rows_copied", r.RowsCopied,
+			)
+		}
+		return nil
+	}
+
+	if c.opts.Parallel > 1 {
+		slog.Warn("Original run was not parallel, resuming with a single reader", "table", c.schema.Table)
+	}
+	c.ranges = []*ReadRange{{Cursor: checkpoint.Cursor}}
+	slog.Info(
+		"Resuming from checkpoint",
+		"table", c.schema.Table,
+		"cursor", checkpoint.Cursor,
+		"rows_copied", checkpoint.RowsCopied,
+	)
+	return nil
+}
+
+// startCheckpoint records a new run reading rows after the given cursor.
+func (c *Copier) startCheckpoint(after Cursor, rowsCopied uint64) error {
+	if err := c.planReadRanges(after); err != nil {
+		return err
+	}
+	checkpoint := NewCheckpoint(c.schema)
+	checkpoint.Cursor = after
+	checkpoint.RowsCopied = rowsCopied
+	if c.parallel {
+		checkpoint.Ranges = c.ranges
+	}
+	return writeCheckpoint(c.sqliteDb, checkpoint)
+}
+
+// planReadRanges splits the table between parallel readers, all of them starting after the given cursor.
+func (c *Copier) planReadRanges(after Cursor) error {
+	if c.opts.Parallel <= 1 {
+		c.ranges = []*ReadRange{{Cursor: after}}
+		return nil
+	}
+	ranges, err := planRanges(c.mysqlDb, c.schema, c.opts.Parallel)
+	if err != nil {
+		return err
+	}
+	for i, r := range ranges {
+		// Ranges entirely below the cursor have nothing left to read
+		r.Cursor = after
+		slog.Info("Planned read range", "table", c.schema.Table, "range", r, "range_index", i)
+	}
+	c.ranges = ranges
+	c.parallel = true
+	return nil
+}
+
+// checkAppend makes sure the existing table was copied with the same columns
+// stored the same way, so new rows can be added to it.
+func (c *Copier) checkAppend() error {
+	exists, err := sqliteTableExists(c.sqliteDb, c.schema.Table)
+	if err != nil || !exists {
+		return err
+	}
+	if err := checkColumnsMetadata(c.sqliteDb, c.schema); err != nil {
+		return err
+	}
+	checkpoint, err := readCheckpoint(c.sqliteDb, c.schema.Table)
+	if err != nil || checkpoint == nil {
+		return err
+	}
+	if err := checkpoint.VerifyColumns(c.schema); err != nil {
+		return err
+	}
+	// Rows left by an interrupted run, e.g. in lower ranges of a parallel one, are not all after the largest id
+	if _, err := c.sqliteDb.Exec(sqliteCreateManifestTableQuery); err != nil {
+		return err
+	}
+	manifest, err := readManifest(c.sqliteDb, c.schema.Table)
+	if err != nil {
+		return err
+	}
+	if manifest != nil && manifest.FinishedAt.IsZero() {
+		return fmt.Errorf("previous copy of table %s did not finish, complete it with --resume first", c.schema.Table)
+	}
 	return nil
 }
 
-func (c *Copier) Wait() {
+// appendCheckpoint starts a new run after the largest id the previous one copied.
+func (c *Copier) appendCheckpoint(previous *Checkpoint) error {
+	var rowsCopied uint64
+	if previous != nil {
+		rowsCopied = previous.RowsCopied
+	}
+	after, err := lastCopiedKey(c.mysqlDb, c.sqliteDb, c.schema)
+	if err != nil {
+		return err
+	}
+	c.appendedAfter = after
+	if after == nil {
+		slog.Info("Table is empty, appending from the beginning", "table", c.schema.Table)
+	} else {
+		slog.Info("Appending after the largest archived id", "table", c.schema.Table, "cursor", after)
+	}
+	return c.startCheckpoint(after, rowsCopied)
+}
+
+func (c *Copier) tableEmpty() (bool, error) {
+	var exists bool
+	query := fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s)", sqlite.Quote(c.schema.Table))
+	err := c.sqliteDb.QueryRow(query).Scan(&exists)
+	return !exists, err
+}
+
+func (c *Copier) RowsWritten() uint64 {
+	return c.rowsWritten
+}
+
+func (c *Copier) RowsPurged() uint64 {
+	return c.rowsPurged
+}
+
+// ShardPaths are the files written when the output is split into shards.
+func (c *Copier) ShardPaths() []string {
+	if c.shards == nil {
+		return nil
+	}
+	return c.shards.Paths()
+}
+
+// AppendedAfter is the largest id archived before the run, as a MySQL key, nil unless appending.
+func (c *Copier) AppendedAfter() Cursor {
+	return c.appendedAfter
+}
+
+// Wait waits for the writer to finish and returns its error.
+func (c *Copier) Wait() error {
 	slog.Info("Wrapping up...")
 	c.wg.Wait()
+	if c.opts.Purge {
+		slog.Info("Purged rows from MySQL", "table", c.schema.Table, "rows_purged", c.rowsPurged)
+	}
+	return c.writeErr
 }
 
 func (c *Copier) Copy() error {
-	slog.Info("Copying data from MySQL to SQLite", "table", c.schema.Table)
+	slog.Info("Copying data from MySQL", "table", c.schema.Table)
 
-	rowsChan := make(chan RowData, c.opts.WriteBatchSize*10) // big channel, let mysql read fast if it can
+	rowsChan := make(chan copiedRow, c.opts.WriteBatchSize*10) // big channel, let mysql read fast if it can
 	defer close(rowsChan)
 
 	c.wg.Add(1)
 	go func() {
 		defer c.wg.Done()
-		err := c.sqliteWriter(rowsChan)
-		if err != nil {
-			slog.Error("Error writing to SQLite", "error", err)
-			panic(err) // TODO: handle it a bit better
+		c.writeErr = c.writer(rowsChan)
+		if c.writeErr != nil {
+			// Stop the readers and let those blocked on a full channel finish
+			c.stopped.Store(true)
+			for range rowsChan {
+			}
 		}
-
 	}()
 
-	var maxSeenId uint64 = 0
-	var totalRowsRead uint64 = 0
-	colsCount := len(c.schema.Columns)
-
-	idColumnIndex := c.schema.ColumnIndex(c.schema.IdColumn)
-	if idColumnIndex == -1 {
-		return fmt.Errorf("%s column not found", c.schema.IdColumn)
-	}
-
-	var batchStartAt time.Time
-	var batchDuration time.Duration
-
 	if c.opts.Limit > 0 && c.opts.Limit < uint64(c.opts.ReadBatchSize) {
 		slog.Info("Limit is less than read batch size, setting read batch size to limit", "limit", c.opts.Limit, "read_batch_size", c.opts.ReadBatchSize)
 		c.opts.ReadBatchSize = int(c.opts.Limit)
 	}
-
-	query := c.schema.MySQLSelectQuery(int64(c.opts.ReadBatchSize))
-	stmt, err := c.mysqlDb.Prepare(query)
-	if err != nil {
-		return err
+	if c.opts.Limit > 0 && c.opts.BatchTiming.Enabled() {
+		c.opts.BatchTiming.MaxSize = min(c.opts.BatchTiming.MaxSize, int(min(c.opts.Limit, math.MaxInt32)))
+		c.opts.BatchTiming.MinSize = min(c.opts.BatchTiming.MinSize, c.opts.BatchTiming.MaxSize)
 	}
-	defer stmt.Close()
+	c.limiter = newRateLimiter(c.opts.RateLimit, len(c.ranges))
 
 	c.opts.Progress.RenderBlank()
 	defer c.opts.Progress.Finish()
 
-	for {
+	var readers sync.WaitGroup
+	errs := make([]error, len(c.ranges))
+	for i, r := range c.ranges {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			errs[i] = c.readRange(i, r, rowsChan)
+			if errs[i] != nil {
+				// No point in reading the rest when the copy has failed anyway
+				c.stopped.Store(true)
+			}
+		}()
+	}
+	readers.Wait()
+
+	return errors.Join(errs...)
+}
+
+// readRange reads rows of a range in batches and sends them to the writer.
+func (c *Copier) readRange(index int, r *ReadRange, rowsChan chan<- copiedRow) error {
+	stmts := &rangeStatements{db: c.mysqlDb, schema: c.schema, r: r}
+	defer stmts.Close()
+
+	var logAttrs []any
+	if c.parallel {
+		logAttrs = []any{"range", r, "range_index", index}
+	}
+
+	cursor := r.Cursor
+	var batchStartAt time.Time
+	var batchDuration time.Duration
+	readBatchSize := c.opts.BatchTiming.Clamp(c.opts.ReadBatchSize)
+
+	for !c.stopped.Load() {
+		if err := c.opts.Throttler.Wait(c.stopped.Load); err != nil {
+			return err
+		}
+		batchSize := c.limiter.BatchSize(readBatchSize)
+		if err := stmts.Prepare(batchSize); err != nil {
+			return err
+		}
 		batchStartAt = time.Now()
-		rows, err := stmt.Query(maxSeenId)
+		var rows *sql.Rows
+		var err error
+		if cursor == nil {
+			rows, err = stmts.first.Query(r.Args()...)
+		} else {
+			rows, err = stmts.next.Query(append(keysetArgs(cursor), r.Args()...)...)
+		}
 		if err != nil {
 			return err
 		}
 		rowsInBatch := 0
+		var bytesInBatch int64
+		var lastRow RowData
 		for rows.Next() {
-			row := make([]any, colsCount)
-			for i := range colsCount {
-				row[i] = reflect.New(c.schema.Columns[i].reflectType).Interface()
-			}
+			row := c.schema.NewRow()
 			err := rows.Scan(row...)
 			if err != nil {
+				rows.Close()
 				return err
 			}
 			rowsInBatch++
-			totalRowsRead++
-
-			switch row[idColumnIndex].(type) {
-			case *int64:
-				rowId := uint64(*row[idColumnIndex].(*int64))
-				if rowId > maxSeenId {
-					maxSeenId = rowId
-				}
-			case *int32:
-				rowId := uint64(*row[idColumnIndex].(*int32))
-				if rowId > maxSeenId {
-					maxSeenId = rowId
-				}
-			case *int16:
-				rowId := uint64(*row[idColumnIndex].(*int16))
-				if rowId > maxSeenId {
-					maxSeenId = rowId
-				}
-			case *int8:
-				rowId := uint64(*row[idColumnIndex].(*int8))
-				if rowId > maxSeenId {
-					maxSeenId = rowId
-				}
-			case *uint64:
-				rowId := *row[idColumnIndex].(*uint64)
-				if rowId > maxSeenId {
-					maxSeenId = rowId
-				}
-			case *uint32:
-				rowId := uint64(*row[idColumnIndex].(*uint32))
-				if rowId > maxSeenId {
-					maxSeenId = rowId
-				}
-			case *uint16:
-				rowId := uint64(*row[idColumnIndex].(*uint16))
-				if rowId > maxSeenId {
-					maxSeenId = rowId
-				}
-			case *uint8:
-				rowId := uint64(*row[idColumnIndex].(*uint8))
-				if rowId > maxSeenId {
-					maxSeenId = rowId
-				}
-			default:
-				return fmt.Errorf("unknown id column type: %T", row[idColumnIndex])
+			lastRow = row
+			if c.limiter != nil {
+				bytesInBatch += rowSize(row)
 			}
 
-			rowsChan <- row
+			totalRowsRead := c.rowsRead.Add(1)
+			rowsChan <- copiedRow{rangeIndex: index, row: row}
 
-			if c.opts.Limit > 0 && totalRowsRead >= c.opts.Limit {
+			if c.opts.Limit > 0 && totalRowsRead == c.opts.Limit {
 				slog.Info("Limit reached, stopping copy", "limit", c.opts.Limit, "total_rows_read", totalRowsRead)
+				c.stopped.Store(true)
 				rows.Close()
 				return nil
 			}
@@ -176,6 +445,7 @@ func (c *Copier) Copy() error {
 			if totalRowsRead%1000 == 0 {
 				err = c.opts.Progress.Add64(1000)
 				if err != nil {
+					rows.Close()
 					return err
 				}
 			}
@@ -185,83 +455,153 @@ func (c *Copier) Copy() error {
 			return err
 		}
 
+		// Rows are ordered by id columns, so the last one is where the next batch starts
+		if lastRow != nil {
+			cursor, err = c.schema.RowCursor(lastRow)
+			if err != nil {
+				return err
+			}
+		}
+
 		count, suffix := humanize.ComputeSI(float64(rowsInBatch))
 		rowsInBatchHumanized := fmt.Sprintf("%d%s", int(count), suffix)
 		batchDuration = time.Since(batchStartAt)
-		slog.Debug(
-			"Batch read from MySQL",
+		attrs := []any{
 			"batch_duration", batchDuration,
 			"rows_in_batch", rowsInBatchHumanized,
-		)
+		}
+		if c.limiter != nil || c.opts.BatchTiming.Enabled() {
+			attrs = append(attrs, "read_batch_size", batchSize)
+		}
+		if c.limiter != nil {
+			c.limiter.Take(int64(rowsInBatch), bytesInBatch)
+			rate := c.limiter.String()
+			attrs = append(attrs, "effective_rate", rate)
+			c.opts.Progress.Describe(fmt.Sprintf("Copying %s at %s", c.schema.Table, rate))
+		}
+		slog.Debug("Batch read from MySQL", append(attrs, logAttrs...)...)
 
-		if rowsInBatch < c.opts.ReadBatchSize {
+		if rowsInBatch < batchSize {
 			break
 		}
+		readBatchSize = c.opts.BatchTiming.Next(readBatchSize, batchSize, batchDuration)
 	}
 	return nil
 }
 
-func (c *Copier) sqliteWriter(inputs <-chan RowData) error {
-	columns := make([]string, len(c.schema.Columns))
-	for i, column := range c.schema.Columns {
-		columns[i] = sqlite.Quote(column.name).String()
-	}
+// rangeStatements are the prepared statements selecting the first and the following batches of a range.
+// They are prepared again whenever the batch size changes.
+type rangeStatements struct {
+	db     *sql.DB
+	schema *Schema
+	r      *ReadRange
 
-	insertQuery := c.schema.SqliteInsertQuery()
+	batchSize int
+	first     *sql.Stmt
+	next      *sql.Stmt
+}
 
-	stmt, err := c.sqliteDb.Prepare(insertQuery)
-	if err != nil {
+func (s *rangeStatements) Prepare(batchSize int) error {
+	if s.first != nil && batchSize == s.batchSize {
+		return nil
+	}
+	s.Close()
+	var err error
+	if s.first, err = s.db.Prepare(s.schema.MySQLSelectRangeQuery(int64(batchSize), false, s.r)); err != nil {
+		return err
+	}
+	if s.next, err = s.db.Prepare(s.schema.MySQLSelectRangeQuery(int64(batchSize), true, s.r)); err != nil {
 		return err
 	}
-	defer stmt.Close()
+	s.batchSize = batchSize
+	return nil
+}
 
-	batch := make([]RowData, 0, c.opts.WriteBatchSize)
+func (s *rangeStatements) Close() {
+	if s.first != nil {
+		s.first.Close()
+		s.first = nil
+	}
+	if s.next != nil {
+		s.next.Close()
+		s.next = nil
+	}
+}
 
-	processBatch := func(batch []RowData) error {
-		batchStartAt := time.Now()
-		if len(batch) == 0 {
-			return nil
+// sqliteTarget is an SQLite file the writer inserts rows into, with the statements prepared for it.
+type sqliteTarget struct {
+	db             *sql.DB
+	insertStmt     *sql.Stmt
+	checkpointStmt *sql.Stmt
+	rangeStmt      *sql.Stmt
+	// purgeStmt records ids to purge, nil unless purging
+	purgeStmt *sql.Stmt
+}
+
+func newSQLiteTarget(db *sql.DB, s *Schema, purge bool) (*sqliteTarget, error) {
+	t := &sqliteTarget{db: db}
+	var err error
+	if t.insertStmt, err = db.Prepare(s.SqliteInsertQuery()); err != nil {
+		return nil, err
+	}
+	if t.checkpointStmt, err = db.Prepare(sqliteUpdateCheckpointQuery); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if t.rangeStmt, err = db.Prepare(sqliteUpdateRangeQuery); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if purge {
+		if _, err := db.Exec(sqliteCreatePurgeTableQuery); err != nil {
+			t.Close()
+			return nil, err
 		}
-		// Begin transaction
-		tx, err := c.sqliteDb.Begin()
-		if err != nil {
-			return err
+		if t.purgeStmt, err = db.Prepare(sqliteInsertPurgeQuery); err != nil {
+			t.Close()
+			return nil, err
 		}
-		defer tx.Rollback() // Will be no-op if transaction is committed
-
-		// Use prepared statement within transaction
-		txStmt := tx.Stmt(stmt)
+	}
+	return t, nil
+}
 
-		for _, row := range batch {
-			_, err := txStmt.Exec(row...)
-			if err != nil {
-				return err
-			}
+func (t *sqliteTarget) Close() {
+	for _, stmt := range []*sql.Stmt{t.insertStmt, t.checkpointStmt, t.rangeStmt, t.purgeStmt} {
+		if stmt != nil {
+			stmt.Close()
 		}
+	}
+}
 
-		// Commit transaction
-		err = tx.Commit()
-		if err != nil {
+// writer collects rows from the readers into batches of WriteBatchSize and hands them to the output.
+func (c *Copier) writer(inputs <-chan copiedRow) error {
+	output := c.opts.Writer
+	if output == nil {
+		var err error
+		if output, err = c.newSQLiteWriter(); err != nil {
 			return err
 		}
+	}
+	defer output.Close()
 
-		batchDuration := time.Since(batchStartAt)
-		count, suffix := humanize.ComputeSI(float64(len(batch)))
-		batchSizeHumanized := fmt.Sprintf("%d%s", int(count), suffix)
-		slog.Debug(
-			"Batch written to SQLite",
-			"batch_duration", batchDuration,
-			"batch_size", batchSizeHumanized,
-		)
-
+	writeBatch := func(batch []copiedRow) error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := output.WriteBatch(batch); err != nil {
+			return err
+		}
+		c.rowsWritten += uint64(len(batch))
 		return nil
 	}
+
+	batch := make([]copiedRow, 0, c.opts.WriteBatchSize)
 	for row := range inputs {
 		batch = append(batch, row)
 
 		// Process batch when it reaches the batch size
 		if len(batch) >= c.opts.WriteBatchSize {
-			if err := processBatch(batch); err != nil {
+			if err := writeBatch(batch); err != nil {
 				return err
 			}
 			batch = batch[:0] // Reset batch slice but keep capacity
@@ -269,11 +609,115 @@ func (c *Copier) sqliteWriter(inputs <-chan RowData) error {
 	}
 
 	// Process remaining rows in the final batch
-	if err := processBatch(batch); err != nil {
+	if err := writeBatch(batch); err != nil {
+		return err
+	}
+	if err := output.Finish(); err != nil {
+		return err
+	}
+
+	slog.Info("Writer finished", "table", c.schema.Table)
+
+	return nil
+}
+
+// writeBatch inserts rows into SQLite file with a single transaction, moving
+// its checkpoint along, and purges them from MySQL once they are committed.
+func (c *Copier) writeBatch(target *sqliteTarget, batch []copiedRow) error {
+	batchStartAt := time.Now()
+	// Begin transaction
+	tx, err := target.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Will be no-op if transaction is committed
+
+	// Use prepared statement within transaction
+	txStmt := tx.Stmt(target.insertStmt)
+	var purgeStmt *sql.Stmt
+	if c.opts.Purge {
+		purgeStmt = tx.Stmt(target.purgeStmt)
+	}
+
+	// Rows of every range come ordered by id columns, so the last one is the furthest it got
+	lastRows := map[int]RowData{}
+	rangeRows := map[int]int{}
+	var keys []Cursor
+	for _, copied := range batch {
+		values, err := c.schema.SqliteValues(copied.row)
+		if err != nil {
+			return err
+		}
+		_, err = txStmt.Exec(values...)
+		if err != nil {
+			return err
+		}
+		lastRows[copied.rangeIndex] = copied.row
+		rangeRows[copied.rangeIndex]++
+
+		if c.opts.Purge {
+			// Committed along with the rows, so the purge is picked up on resume if it does not happen
+			key, err := c.schema.RowCursor(copied.row)
+			if err != nil {
+				return err
+			}
+			encoded, err := key.Encode()
+			if err != nil {
+				return err
+			}
+			if _, err := purgeStmt.Exec(c.schema.Table, encoded); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	var encodedCursor sql.NullString
+	for index, lastRow := range lastRows {
+		cursor, err := c.schema.RowCursor(lastRow)
+		if err != nil {
+			return err
+		}
+		encoded, err := cursor.Encode()
+		if err != nil {
+			return err
+		}
+		// Shards are not resumed, their checkpoints only count rows
+		if !c.parallel || c.shards != nil {
+			encodedCursor = sql.NullString{String: encoded, Valid: true}
+			continue
+		}
+		_, err = tx.Stmt(target.rangeStmt).Exec(encoded, rangeRows[index], c.schema.Table, index)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Stmt(target.checkpointStmt).Exec(
+		encodedCursor, len(batch), time.Now().UTC().Format(time.RFC3339), c.schema.Table,
+	)
+	if err != nil {
 		return err
 	}
 
-	slog.Info("SQLite writer finished")
+	// Commit transaction
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	batchDuration := time.Since(batchStartAt)
+	count, suffix := humanize.ComputeSI(float64(len(batch)))
+	batchSizeHumanized := fmt.Sprintf("%d%s", int(count), suffix)
+	slog.Debug(
+		"Batch written to SQLite",
+		"batch_duration", batchDuration,
+		"batch_size", batchSizeHumanized,
+	)
+
+	if c.opts.Purge {
+		if err := c.purge(target.db, keys); err != nil {
+			return fmt.Errorf("purging rows from MySQL: %w", err)
+		}
+	}
 
 	return nil
 }
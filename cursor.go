@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor holds values of key columns of the last seen row, in order of
+// Schema.IdColumns. Nil cursor means nothing has been seen yet.
+type Cursor []any
+
+func (c Cursor) String() string {
+	if c == nil {
+		return "none"
+	}
+	values := make([]string, len(c))
+	for i, value := range c {
+		switch v := value.(type) {
+		case []byte:
+			values[i] = fmt.Sprintf("0x%x", v)
+		case time.Time:
+			values[i] = v.Format(time.RFC3339Nano)
+		default:
+			values[i] = fmt.Sprint(v)
+		}
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	return "(" + strings.Join(values, ", ") + ")"
+}
+
+// Encode serializes cursor into a string keeping value types,
+// so it can be stored in a checkpoint and bound to queries again.
+func (c Cursor) Encode() (string, error) {
+	values := make([]string, len(c))
+	for i, value := range c {
+		switch v := value.(type) {
+		case nil:
+			values[i] = "null:"
+		case int64:
+			values[i] = "int:" + strconv.FormatInt(v, 10)
+		case uint64:
+			values[i] = "uint:" + strconv.FormatUint(v, 10)
+		case float64:
+			values[i] = "float:" + strconv.FormatFloat(v, 'g', -1, 64)
+		case string:
+			values[i] = "string:" + v
+		case []byte:
+			values[i] = "bytes:" + base64.StdEncoding.EncodeToString(v)
+		case time.Time:
+			values[i] = "time:" + v.Format(time.RFC3339Nano)
+		default:
+			return "", fmt.Errorf("can not encode cursor value of type %T", value)
+		}
+	}
+	encoded, err := json.Marshal(values)
+	return string(encoded), err
+}
+
+func DecodeCursor(encoded string) (Cursor, error) {
+	var values []string
+	if err := json.Unmarshal([]byte(encoded), &values); err != nil {
+		return nil, fmt.Errorf("malformed cursor: %w", err)
+	}
+
+	cursor := make(Cursor, len(values))
+	for i, value := range values {
+		kind, raw, found := strings.Cut(value, ":")
+		if !found {
+			return nil, fmt.Errorf("malformed cursor value %q", value)
+		}
+		var err error
+		switch kind {
+		case "null":
+			cursor[i] = nil
+		case "int":
+			cursor[i], err = strconv.ParseInt(raw, 10, 64)
+		case "uint":
+			cursor[i], err = strconv.ParseUint(raw, 10, 64)
+		case "float":
+			cursor[i], err = strconv.ParseFloat(raw, 64)
+		case "string":
+			cursor[i] = raw
+		case "bytes":
+			cursor[i], err = base64.StdEncoding.DecodeString(raw)
+		case "time":
+			cursor[i], err = time.Parse(time.RFC3339Nano, raw)
+		default:
+			err = fmt.Errorf("unknown cursor value type %q", kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed cursor value %q: %w", value, err)
+		}
+	}
+	return cursor, nil
+}
+
+// cursorValue turns a scanned column value into a plain one,
+// suitable for binding to queries and encoding.
+func cursorValue(scanned any) (any, error) {
+	value, err := scannedValue(scanned)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case nil, int64, uint64, float64, string, time.Time:
+		return v, nil
+	case []byte:
+		return append([]byte{}, v...), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case uint8:
+		return uint64(v), nil
+	case uint16:
+		return uint64(v), nil
+	case uint32:
+		return uint64(v), nil
+	case float32:
+		return float64(v), nil
+	default:
+		return nil, fmt.Errorf("unsupported key column type: %T", value)
+	}
+}
+
+// keysetPredicate compares tuple of key columns with a cursor. With lower set it
+// selects rows after the cursor, otherwise rows up to and including it.
+// For keys (a, b) and lower bound it looks like:
+//
+//	a >= ? AND (a > ? OR (a = ? AND b > ?))
+//
+// Expanded form is used instead of row constructors as MySQL can not always
+// use an index for the latter, leading comparison helps to narrow the range.
+func keysetPredicate(keys []string, quote func(string) string, lower bool) string {
+	strict, inclusive := "<", "<="
+	if lower {
+		strict, inclusive = ">", ">"
+	}
+
+	terms := make([]string, len(keys))
+	for i := range keys {
+		parts := make([]string, 0, i+1)
+		for _, key := range keys[:i] {
+			parts = append(parts, fmt.Sprintf("%s = ?", quote(key)))
+		}
+		op := strict
+		if i == len(keys)-1 {
+			op = inclusive
+		}
+		parts = append(parts, fmt.Sprintf("%s %s ?", quote(keys[i]), op))
+		terms[i] = strings.Join(parts, " AND ")
+	}
+
+	if len(keys) == 1 {
+		return terms[0]
+	}
+
+	leading := "<="
+	if lower {
+		leading = ">="
+	}
+	for i, term := range terms {
+		if i > 0 {
+			terms[i] = "(" + term + ")"
+		}
+	}
+	return fmt.Sprintf("%s %s ? AND (%s)", quote(keys[0]), leading, strings.Join(terms, " OR "))
+}
+
+// keysetArgs returns cursor values in order of placeholders of keysetPredicate.
+// Nil cursor has no arguments.
+func keysetArgs(cursor Cursor) []any {
+	if len(cursor) == 0 {
+		return nil
+	}
+	if len(cursor) == 1 {
+		return []any{cursor[0]}
+	}
+	args := []any{cursor[0]}
+	for i := range cursor {
+		args = append(args, cursor[:i+1]...)
+	}
+	return args
+}
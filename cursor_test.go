@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursorEncode(t *testing.T) {
+	cursors := []Cursor{
+		{int64(-42)},
+		{uint64(18446744073709551615)},
+		{"abc:def", []byte{0, 1, 255}},
+		{time.Date(2025, 1, 2, 3, 4, 5, 6, time.UTC), float64(1.5), nil},
+	}
+
+	for _, cursor := range cursors {
+		encoded, err := cursor.Encode()
+		if err != nil {
+			t.Fatalf("Encode(%v) error = %v", cursor, err)
+		}
+		decoded, err := DecodeCursor(encoded)
+		if err != nil {
+			t.Fatalf("DecodeCursor(%q) error = %v", encoded, err)
+		}
+		if !reflect.DeepEqual(decoded, cursor) {
+			t.Errorf("DecodeCursor(%q) = %#v, want %#v", encoded, decoded, cursor)
+		}
+	}
+}
+
+func TestKeysetPredicate(t *testing.T) {
+	tests := []struct {
+		name  string
+		keys  []string
+		lower bool
+		want  string
+	}{
+		{"single lower", []string{"id"}, true, "`id` > ?"},
+		{"single upper", []string{"id"}, false, "`id` <= ?"},
+		{
+			"composite lower", []string{"a", "b"}, true,
+			"`a` >= ? AND (`a` > ? OR (`a` = ? AND `b` > ?))",
+		},
+		{
+			"composite upper", []string{"a", "b", "c"}, false,
+			"`a` <= ? AND (`a` < ? OR (`a` = ? AND `b` < ?) OR (`a` = ? AND `b` = ? AND `c` <= ?))",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := keysetPredicate(tt.keys, quoteMySQL, tt.lower)
+			if got != tt.want {
+				t.Errorf("keysetPredicate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeysetArgs(t *testing.T) {
+	got := keysetArgs(Cursor{"x", int64(2)})
+	want := []any{"x", "x", "x", int64(2)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keysetArgs() = %v, want %v", got, want)
+	}
+	if got := keysetArgs(nil); got != nil {
+		t.Errorf("keysetArgs(nil) = %v, want nil", got)
+	}
+}
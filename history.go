@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	buildInfo "github.com/bak1an/arklite/version"
+)
+
+// How a run wrote into the table
+const (
+	RunCopy   = "copy"
+	RunResume = "resume"
+	RunAppend = "append"
+)
+
+// _arklite_history has a row for every run which wrote into a table of the archive.
+const sqliteCreateHistoryTableQuery = `
+CREATE TABLE IF NOT EXISTS "_arklite_history" (
+  "run_id" INTEGER PRIMARY KEY,
+  "table_name" TEXT NOT NULL,
+  "mode" TEXT NOT NULL,
+  "partition_name" TEXT NOT NULL,
+  "where_clauses" TEXT NOT NULL,
+  "after_id" TEXT,
+  "last_id" TEXT,
+  "rows_copied" INTEGER NOT NULL,
+  "started_at" TEXT NOT NULL,
+  "finished_at" TEXT,
+  "arklite_version" TEXT NOT NULL
+)`
+
+const sqliteInsertHistoryQuery = `
+INSERT INTO "_arklite_history" (
+  "table_name", "mode", "partition_name", "where_clauses", "after_id", "rows_copied", "started_at", "arklite_version"
+) VALUES (?, ?, ?, ?, ?, 0, ?, ?)`
+
+const sqliteFinishHistoryQuery = `
+UPDATE "_arklite_history"
+SET "last_id" = ?, "rows_copied" = ?, "finished_at" = ?
+WHERE "run_id" = ?`
+
+const sqliteSelectHistoryQuery = `
+SELECT "run_id", "table_name", "mode", "partition_name", "where_clauses", "after_id", "last_id", "rows_copied", "started_at", "finished_at"
+FROM "_arklite_history"
+WHERE "table_name" = ?
+ORDER BY "run_id"`
+
+// Run is an entry of the archive history.
+type Run struct {
+	Id        int64
+	Table     string
+	Mode      string
+	Partition string
+	Where     []string
+	// AfterId is the largest id archived before an append, LastId is the largest one after the run.
+	// Both are as the ids are stored in SQLite.
+	AfterId    Cursor
+	LastId     Cursor
+	RowsCopied uint64
+	StartedAt  time.Time
+	// FinishedAt is zero for runs which did not finish
+	FinishedAt time.Time
+}
+
+// startRun records the beginning of a run in the history of the table.
+func startRun(db *sql.DB, s *Schema, mode string, afterId Cursor) (*Run, error) {
+	run := &Run{
+		Table:     s.Table,
+		Mode:      mode,
+		Partition: s.Partition,
+		Where:     s.Where,
+		AfterId:   afterId,
+		StartedAt: time.Now().UTC(),
+	}
+	if run.Where == nil {
+		run.Where = []string{}
+	}
+	if _, err := db.Exec(sqliteCreateHistoryTableQuery); err != nil {
+		return nil, err
+	}
+	where, err := json.Marshal(run.Where)
+	if err != nil {
+		return nil, err
+	}
+	version, err := json.Marshal(buildInfo.GetBuildInfo())
+	if err != nil {
+		return nil, err
+	}
+	after, err := encodeIdBound(afterId)
+	if err != nil {
+		return nil, err
+	}
+	result, err := db.Exec(
+		sqliteInsertHistoryQuery,
+		run.Table, run.Mode, run.Partition, string(where), after, run.StartedAt.Format(time.RFC3339), string(version),
+	)
+	if err != nil {
+		return nil, err
+	}
+	run.Id, err = result.LastInsertId()
+	return run, err
+}
+
+// finishRun records the outcome of a run once it is done.
+func finishRun(db *sql.DB, run *Run, lastId Cursor, rowsCopied uint64) error {
+	run.LastId = lastId
+	run.RowsCopied = rowsCopied
+	run.FinishedAt = time.Now().UTC()
+	last, err := encodeIdBound(lastId)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(sqliteFinishHistoryQuery, last, run.RowsCopied, run.FinishedAt.Format(time.RFC3339), run.Id)
+	return err
+}
+
+// readHistory reads runs of the table, oldest first. Archives made before
+// the history was recorded have none.
+func readHistory(db *sql.DB, table string) ([]*Run, error) {
+	if exists, err := sqliteTableExists(db, "_arklite_history"); err != nil || !exists {
+		return nil, err
+	}
+	rows, err := db.Query(sqliteSelectHistoryQuery, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []*Run
+	for rows.Next() {
+		run := &Run{}
+		var where, startedAt string
+		var afterId, lastId, finishedAt sql.NullString
+		err := rows.Scan(
+			&run.Id, &run.Table, &run.Mode, &run.Partition, &where, &afterId, &lastId, &run.RowsCopied, &startedAt, &finishedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(where), &run.Where); err != nil {
+			return nil, fmt.Errorf("malformed history of table %s: %w", run.Table, err)
+		}
+		if run.AfterId, err = decodeIdBound(afterId); err != nil {
+			return nil, err
+		}
+		if run.LastId, err = decodeIdBound(lastId); err != nil {
+			return nil, err
+		}
+		if run.StartedAt, err = time.Parse(time.RFC3339, startedAt); err != nil {
+			return nil, fmt.Errorf("malformed history of table %s: %w", run.Table, err)
+		}
+		if finishedAt.Valid {
+			if run.FinishedAt, err = time.Parse(time.RFC3339, finishedAt.String); err != nil {
+				return nil, fmt.Errorf("malformed history of table %s: %w", run.Table, err)
+			}
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// printHistory prints runs of a table one per line.
+func printHistory(out io.Writer, runs []*Run) {
+	if len(runs) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "History:\n")
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	for _, run := range runs {
+		finished := "not finished"
+		if !run.FinishedAt.IsZero() {
+			finished = run.FinishedAt.Format(time.RFC3339)
+		}
+		ids := "..."
+		if run.AfterId != nil {
+			ids = run.AfterId.String()
+		}
+		line := fmt.Sprintf(
+			"  %s\t%s\t%s\tids (%s, %s]\t%d rows",
+			run.StartedAt.Format(time.RFC3339), finished, run.Mode, ids, run.LastId, run.RowsCopied,
+		)
+		if len(run.Where) > 0 {
+			line += "\twhere " + strings.Join(run.Where, " AND ")
+		}
+		fmt.Fprintln(w, line)
+	}
+	w.Flush()
+}
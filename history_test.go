@@ -0,0 +1,55 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestHistory(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// Archives made before the history was recorded
+	if runs, err := readHistory(db, "orders"); err != nil || runs != nil {
+		t.Fatalf("readHistory() = %v, %v, want no runs", runs, err)
+	}
+
+	s := &Schema{Table: "orders", IdColumns: []string{"id"}, Where: []string{"id < 100"}}
+	first, err := startRun(db, s, RunCopy, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := finishRun(db, first, Cursor{int64(99)}, 99); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := startRun(db, s, RunAppend, Cursor{int64(99)}); err != nil {
+		t.Fatal(err)
+	}
+
+	runs, err := readHistory(db, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("got %d runs, want 2", len(runs))
+	}
+	if runs[0].Mode != RunCopy || runs[0].RowsCopied != 99 || runs[0].AfterId != nil || runs[0].FinishedAt.IsZero() {
+		t.Errorf("first run = %+v", runs[0])
+	}
+	if want := (Cursor{int64(99)}); !reflect.DeepEqual(runs[0].LastId, want) {
+		t.Errorf("first run LastId = %v, want %v", runs[0].LastId, want)
+	}
+	if runs[1].Mode != RunAppend || !reflect.DeepEqual(runs[1].AfterId, Cursor{int64(99)}) || !runs[1].FinishedAt.IsZero() {
+		t.Errorf("second run = %+v", runs[1])
+	}
+	if !reflect.DeepEqual(runs[1].Where, s.Where) {
+		t.Errorf("second run Where = %v, want %v", runs[1].Where, s.Where)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+type IndexInfo struct {
+	name      string
+	unique    bool
+	indexType string
+	columns   []string
+	// prefix is set when some of the columns are indexed by prefix only
+	prefix bool
+	// expression is set when some of the key parts are expressions, not columns
+	expression bool
+	// nullable is set when some of the columns are nullable
+	nullable bool
+}
+
+func (i *IndexInfo) primary() bool {
+	return i.name == "PRIMARY"
+}
+
+// ordered tells if rows can be read in order of the index columns using it.
+func (i *IndexInfo) ordered() bool {
+	return !i.prefix && !i.expression && i.indexType != "FULLTEXT" && i.indexType != "SPATIAL"
+}
+
+// sqliteUnsupported tells why the index can not be recreated in SQLite
+// for the given schema, empty string means it can.
+func (i *IndexInfo) sqliteUnsupported(s *Schema) string {
+	switch {
+	case i.indexType == "FULLTEXT" || i.indexType == "SPATIAL":
+		return strings.ToLower(i.indexType) + " indexes are not supported"
+	case i.prefix:
+		return "column prefix indexes are not supported"
+	case i.expression:
+		return "functional indexes are not supported"
+	}
+	for _, column := range i.columns {
+		if s.ColumnIndex(column) < 0 {
+			return fmt.Sprintf("column %s is not copied", column)
+		}
+	}
+	return ""
+}
+
+// covers tells how many of the leading columns of the index match leading id columns.
+func (i *IndexInfo) covers(idColumns []string) int {
+	n := 0
+	for n < len(i.columns) && n < len(idColumns) && i.columns[n] == idColumns[n] {
+		n++
+	}
+	return n
+}
+
+func fetchIndexes(db *sql.DB, table string) ([]*IndexInfo, error) {
+	rows, err := db.Query(`
+SELECT INDEX_NAME, NON_UNIQUE, COLUMN_NAME, SUB_PART, INDEX_TYPE, NULLABLE
+FROM information_schema.STATISTICS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+ORDER BY INDEX_NAME, SEQ_IN_INDEX`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []*IndexInfo
+	for rows.Next() {
+		var name, indexType string
+		var nonUnique int
+		var column, nullable sql.NullString
+		var subPart sql.NullInt64
+		if err := rows.Scan(&name, &nonUnique, &column, &subPart, &indexType, &nullable); err != nil {
+			return nil, err
+		}
+
+		if len(indexes) == 0 || indexes[len(indexes)-1].name != name {
+			indexes = append(indexes, &IndexInfo{
+				name:      name,
+				unique:    nonUnique == 0,
+				indexType: strings.ToUpper(indexType),
+			})
+		}
+		index := indexes[len(indexes)-1]
+		// Functional key parts have no column, such index is of no use for pagination
+		if !column.Valid {
+			index.expression = true
+			continue
+		}
+		index.columns = append(index.columns, column.String)
+		index.prefix = index.prefix || subPart.Valid
+		index.nullable = index.nullable || nullable.String == "YES"
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Primary key goes first
+	slices.SortStableFunc(indexes, func(a, b *IndexInfo) int {
+		if a.primary() == b.primary() {
+			return 0
+		}
+		if a.primary() {
+			return -1
+		}
+		return 1
+	})
+	return indexes, nil
+}
+
+// DetectIdColumns picks the primary key of a table or, when there is none,
+// the shortest unique index over NOT NULL columns.
+func DetectIdColumns(db *sql.DB, table string) ([]string, error) {
+	indexes, err := fetchIndexes(db, table)
+	if err != nil {
+		return nil, err
+	}
+
+	index := keyIndex(indexes)
+	if index == nil {
+		return nil, fmt.Errorf("table %s has no primary key or unique index on NOT NULL columns, choose id columns with --id-column", table)
+	}
+	return index.columns, nil
+}
+
+func keyIndex(indexes []*IndexInfo) *IndexInfo {
+	var best *IndexInfo
+	for _, index := range indexes {
+		if !index.unique || index.nullable || !index.ordered() {
+			continue
+		}
+		if index.primary() {
+			return index
+		}
+		if best == nil || len(index.columns) < len(best.columns) {
+			best = index
+		}
+	}
+	return best
+}
+
+// idIndex finds the index best matching id columns, preferring the one
+// covering most of them. Nil means the leading id column is not indexed.
+func idIndex(indexes []*IndexInfo, idColumns []string) *IndexInfo {
+	var best *IndexInfo
+	bestCovers := 0
+	for _, index := range indexes {
+		if !index.ordered() {
+			continue
+		}
+		if covers := index.covers(idColumns); covers > bestCovers {
+			best, bestCovers = index, covers
+		}
+	}
+	return best
+}
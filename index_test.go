@@ -0,0 +1,93 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestKeyIndex(t *testing.T) {
+	primary := &IndexInfo{name: "PRIMARY", unique: true, indexType: "BTREE", columns: []string{"id"}}
+	uniqueWide := &IndexInfo{name: "u_wide", unique: true, indexType: "BTREE", columns: []string{"a", "b"}}
+	uniqueNarrow := &IndexInfo{name: "u_narrow", unique: true, indexType: "BTREE", columns: []string{"code"}}
+	uniqueNullable := &IndexInfo{name: "u_null", unique: true, indexType: "BTREE", columns: []string{"x"}, nullable: true}
+	uniquePrefix := &IndexInfo{name: "u_prefix", unique: true, indexType: "BTREE", columns: []string{"name"}, prefix: true}
+	plain := &IndexInfo{name: "idx", indexType: "BTREE", columns: []string{"created_at"}}
+
+	tests := []struct {
+		name    string
+		indexes []*IndexInfo
+		want    *IndexInfo
+	}{
+		{"primary key", []*IndexInfo{primary, uniqueNarrow}, primary},
+		{"shortest unique", []*IndexInfo{uniqueWide, uniqueNarrow, plain}, uniqueNarrow},
+		{"unusable unique", []*IndexInfo{uniqueNullable, uniquePrefix, plain}, nil},
+		{"no indexes", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keyIndex(tt.indexes); got != tt.want {
+				t.Errorf("keyIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdIndex(t *testing.T) {
+	primary := &IndexInfo{name: "PRIMARY", unique: true, indexType: "BTREE", columns: []string{"tenant_id", "id"}}
+	byTenant := &IndexInfo{name: "idx_tenant", indexType: "BTREE", columns: []string{"tenant_id"}}
+	fulltext := &IndexInfo{name: "ft_title", indexType: "FULLTEXT", columns: []string{"title"}}
+	indexes := []*IndexInfo{primary, byTenant, fulltext}
+
+	tests := []struct {
+		name      string
+		idColumns []string
+		want      *IndexInfo
+	}{
+		{"full key", []string{"tenant_id", "id"}, primary},
+		{"leading column", []string{"tenant_id"}, primary},
+		{"partially covered", []string{"tenant_id", "created_at"}, primary},
+		{"not leading", []string{"id"}, nil},
+		{"fulltext", []string{"title"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := idIndex(indexes, tt.idColumns); got != tt.want {
+				t.Errorf("idIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSQLiteIndexes(t *testing.T) {
+	s := &Schema{
+		Table:     "orders",
+		IdColumns: []string{"id"},
+		Columns: []*ColumnInfo{
+			{name: "id"}, {name: "user_id"}, {name: "created_at"}, {name: "title"},
+		},
+		Indexes: []*IndexInfo{
+			{name: "PRIMARY", unique: true, indexType: "BTREE", columns: []string{"id"}},
+			{name: "u_id", unique: true, indexType: "BTREE", columns: []string{"id"}},
+			{name: "idx_user", indexType: "BTREE", columns: []string{"user_id", "created_at"}},
+			{name: "u_title", unique: true, indexType: "BTREE", columns: []string{"title"}},
+			{name: "idx_prefix", indexType: "BTREE", columns: []string{"title"}, prefix: true},
+			{name: "idx_expr", indexType: "BTREE", expression: true},
+			{name: "ft_title", indexType: "FULLTEXT", columns: []string{"title"}},
+			{name: "idx_dropped", indexType: "BTREE", columns: []string{"user_id", "secret"}},
+		},
+	}
+
+	want := []string{
+		`CREATE INDEX IF NOT EXISTS "orders_idx_user" ON "orders" ("user_id", "created_at")`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS "orders_u_title" ON "orders" ("title")`,
+	}
+	var got []string
+	for _, index := range s.SQLiteIndexes() {
+		got = append(got, s.SQLiteCreateIndexQuery(index))
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("SQLiteIndexes() queries = %q, want %q", got, want)
+	}
+}
@@ -2,14 +2,18 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"math"
 	"os"
 	"slices"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	buildInfo "github.com/bak1an/arklite/version"
+	"github.com/dustin/go-humanize"
 	"github.com/schollz/progressbar/v3"
 	"github.com/spf13/pflag"
 	"golang.org/x/term"
@@ -18,16 +22,8 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Journal and synchronous modes are set by sqliteDSN, on every connection
 const sqliteConfigQuery = `
--- Disable journaling completely (most dangerous but fastest)
-PRAGMA journal_mode = OFF;
-
--- Or use memory-based journaling if you want some crash recovery
--- PRAGMA journal_mode = MEMORY;
-
--- Disable synchronous writes (don't wait for disk to confirm writes)
-PRAGMA synchronous = OFF;
-
 -- Increase cache size (in pages, -ve numbers = KB)
 PRAGMA cache_size = -64000;  -- 64MB cache
 
@@ -50,10 +46,22 @@ PRAGMA foreign_keys = OFF;
 PRAGMA wal_autocheckpoint = 0;
 `
 
+// sqliteDSN opens SQLite output file with a rollback journal, so a batch interrupted by a crash
+// is rolled back instead of leaving partial rows or a corrupted file behind, and any run can be
+// resumed. Writes are not synced to disk, which only matters when the OS crashes, unless durable
+// asks for it: rows purged from MySQL right after a commit must not be lost on a power loss.
+func sqliteDSN(path string, durable bool) string {
+	if durable {
+		return path + "?_journal_mode=TRUNCATE&_synchronous=FULL"
+	}
+	return path + "?_journal_mode=TRUNCATE&_synchronous=OFF"
+}
+
 type ProgressRenderer interface {
 	Add64(count int64) error
 	Finish() error
 	RenderBlank() error
+	Describe(description string)
 }
 
 type NoopProgressBar struct{}
@@ -70,49 +78,592 @@ func (n *NoopProgressBar) RenderBlank() error {
 	return nil
 }
 
+func (n *NoopProgressBar) Describe(description string) {}
+
+type command struct {
+	name        string
+	description string
+}
+
+var commands = []command{
+	{"copy", "Copy MySQL table into SQLite file (default)"},
+	{"verify", "Compare existing SQLite file with MySQL table"},
+	{"info", "Print the manifest of existing SQLite file"},
+	{"restore", "Insert rows of existing SQLite file back into MySQL table"},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: arklite [command] [flags]\n\nCommands:\n")
+	for _, command := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", command.name, command.description)
+	}
+	fmt.Fprintf(os.Stderr, "\nFlags:\n")
+	pflag.PrintDefaults()
+}
+
+func newProgress(noProgress bool, description string) ProgressRenderer {
+	if noProgress {
+		return &NoopProgressBar{}
+	}
+	return progressbar.NewOptions64(
+		-1,
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionShowIts(),
+		progressbar.OptionSetItsString("rows"),
+		progressbar.OptionShowCount(),
+		progressbar.OptionUseANSICodes(true),
+		progressbar.OptionThrottle(time.Second),
+		progressbar.OptionSetElapsedTime(true),
+		progressbar.OptionSetPredictTime(true),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(os.Stderr, "\n")
+		}),
+		progressbar.OptionSetWriter(os.Stderr),
+	)
+}
+
+// printInfo prints manifests of all tables of SQLite file, or of the given ones only.
+func printInfo(sqliteFile string, tables []string) error {
+	if _, err := os.Stat(sqliteFile); err != nil {
+		return err
+	}
+	sqliteDb, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", sqliteFile))
+	if err != nil {
+		return err
+	}
+	defer sqliteDb.Close()
+
+	var exists bool
+	err = sqliteDb.QueryRow(`SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = '_arklite_meta'`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%s has no manifest, it was copied by an older arklite or is not an arklite archive", sqliteFile)
+	}
+
+	manifests, err := readManifests(sqliteDb, tables...)
+	if err != nil {
+		return err
+	}
+	if len(manifests) == 0 {
+		return fmt.Errorf("no manifest found for tables %s", strings.Join(tables, ", "))
+	}
+	for i, manifest := range manifests {
+		if i > 0 {
+			fmt.Println()
+		}
+		printManifest(os.Stdout, manifest)
+		runs, err := readHistory(sqliteDb, manifest.Table)
+		if err != nil {
+			return err
+		}
+		printHistory(os.Stdout, runs)
+	}
+	return nil
+}
+
+// verifyArchive runs a Verifier and prints its report, returns false if any mismatches were found.
+func verifyArchive(mysqlDb *sql.DB, sqliteDb *sql.DB, schema *Schema, opts VerifierOptions) (bool, error) {
+	verifier := NewVerifier(mysqlDb, sqliteDb, schema, opts)
+	result, err := verifier.Verify()
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf(
+		"Verified %d chunks: %d rows in MySQL, %d rows in SQLite\n",
+		result.Chunks, result.MySQLRows, result.SQLiteRows,
+	)
+	if result.Ok() {
+		fmt.Println("SQLite data matches MySQL")
+		return true, nil
+	}
+	if len(result.Mismatches) > 0 {
+		fmt.Printf("Found %d mismatched id ranges:\n", len(result.Mismatches))
+		for _, mismatch := range result.Mismatches {
+			fmt.Printf("  %s\n", mismatch)
+		}
+	}
+	if result.UnmatchedSQLiteRows > 0 {
+		fmt.Printf("Found %d rows in SQLite with ids not in MySQL\n", result.UnmatchedSQLiteRows)
+	}
+	return false, nil
+}
+
+// limitedUpTo is the largest id archived when --limit is given, so that only rows up to it are verified.
+// Rows a limited copy has not reached are not compared, be it the first run or a resumed one.
+func limitedUpTo(mysqlDb *sql.DB, sqliteDb *sql.DB, schema *Schema, limit uint64) (Cursor, error) {
+	if limit == 0 {
+		return nil, nil
+	}
+	return lastCopiedKey(mysqlDb, sqliteDb, schema)
+}
+
+// openMySQL opens the connection pool and checks that MySQL is reachable.
+func openMySQL(config *mysql.Config) (*sql.DB, error) {
+	db, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// restoreArchive inserts rows of the given archived tables back into MySQL and prints how many were restored.
+func restoreArchive(mysqlDb *sql.DB, sqliteFile string, specs []TableSpec, opts RestorerOptions, noProgress bool) error {
+	if _, err := os.Stat(sqliteFile); err != nil {
+		return err
+	}
+	sqliteDb, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", sqliteFile))
+	if err != nil {
+		return err
+	}
+	defer sqliteDb.Close()
+
+	tables, err := archivedTables(sqliteDb, specs)
+	if err != nil {
+		return err
+	}
+	if opts.Target != "" && len(tables) > 1 {
+		return fmt.Errorf("--restore-into needs a single table, got %s", strings.Join(tables, ", "))
+	}
+
+	lines := make([]string, 0, len(tables))
+	for _, table := range tables {
+		restoreStartAt := time.Now()
+		opts.Progress = newProgress(noProgress, fmt.Sprintf("Restoring %s", table))
+		restorer := NewRestorer(mysqlDb, sqliteDb, table, opts)
+		if err := restorer.Prepare(); err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+		if err := restorer.Restore(); err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+		lines = append(lines, fmt.Sprintf(
+			"  %s\t%d rows restored into %s\tin %s",
+			table, restorer.RowsRestored(), restorer.opts.Target, time.Since(restoreStartAt).Round(time.Millisecond),
+		))
+	}
+
+	fmt.Println("\nSummary:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
+
+// connectReplicas opens connections to replicas which lag is checked by the throttler.
+func connectReplicas(addrs []string, source *mysql.Config) ([]Replica, error) {
+	var replicas []Replica
+	for _, addr := range addrs {
+		config, err := parseReplica(addr, source)
+		if err != nil {
+			return nil, fmt.Errorf("bad --replica %q: %w", addr, err)
+		}
+		db, err := sql.Open("mysql", config.FormatDSN())
+		if err != nil {
+			return nil, err
+		}
+		db.SetMaxOpenConns(1)
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%s: %w", config.Addr, err)
+		}
+		replicas = append(replicas, Replica{Name: config.Addr, Db: db})
+	}
+	return replicas, nil
+}
+
+// copyFiles copies every table into a file of the given format, named by the output with {table} placeholder.
+func copyFiles(mysqlDb *sql.DB, schemas []*Schema, output string, fileOpts FileOptions, force bool, copierOpts CopierOptions, noProgress bool) {
+	summaries := make([]tableSummary, 0, len(schemas))
+	for _, schema := range schemas {
+		copyStartAt := time.Now()
+		path := strings.ReplaceAll(output, "{table}", schema.Table)
+		if _, err := os.Stat(path); err == nil && !force {
+			slog.Error("File already exists, use --force to overwrite", "table", schema.Table, "file", path)
+			os.Exit(1)
+		}
+		writer, err := newFileWriter(path, schema, fileOpts)
+		if err != nil {
+			slog.Error("Error creating file", "table", schema.Table, "file", path, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("Writing file", "table", schema.Table, "file", path, "format", fileOpts.Format)
+		copierOpts.Writer = writer
+		copierOpts.Progress = newProgress(noProgress, fmt.Sprintf("Copying %s", schema.Table))
+		copier := NewCopier(mysqlDb, nil, schema, copierOpts)
+
+		if err := copier.InitCheckpoint(); err != nil {
+			slog.Error("Error planning read ranges", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		if err := copier.Copy(); err != nil {
+			slog.Error("Error copying data", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		if err := copier.Wait(); err != nil {
+			slog.Error("Error writing file", "table", schema.Table, "file", path, "error", err)
+			os.Exit(1)
+		}
+		summaries = append(summaries, tableSummary{
+			table:    schema.Table,
+			rows:     copier.RowsWritten(),
+			duration: time.Since(copyStartAt),
+			files:    []string{path},
+		})
+	}
+	printSummary(summaries)
+}
+
+// copyShards copies tables into shard files, every one of them a complete archive.
+func copyShards(mysqlDb *sql.DB, schemas []*Schema, shardOpts ShardOptions, copierOpts CopierOptions, noProgress bool) {
+	summaries := make([]tableSummary, 0, len(schemas))
+	for _, schema := range schemas {
+		copyStartAt := time.Now()
+		copierOpts.Shards = &shardOpts
+		copierOpts.Progress = newProgress(noProgress, fmt.Sprintf("Copying %s", schema.Table))
+		copier := NewCopier(mysqlDb, nil, schema, copierOpts)
+
+		if err := copier.InitCheckpoint(); err != nil {
+			slog.Error("Error preparing shards", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		if err := copier.Copy(); err != nil {
+			slog.Error("Error copying data", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		if err := copier.Wait(); err != nil {
+			slog.Error("Error writing to SQLite", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		summaries = append(summaries, tableSummary{
+			table:      schema.Table,
+			rows:       copier.RowsWritten(),
+			rowsPurged: copier.RowsPurged(),
+			duration:   time.Since(copyStartAt),
+			purged:     copierOpts.Purge,
+			files:      copier.ShardPaths(),
+		})
+	}
+	printSummary(summaries)
+}
+
+type tableSummary struct {
+	table      string
+	rows       uint64
+	rowsPurged uint64
+	duration   time.Duration
+	purged     bool
+	verified   *bool
+	files      []string
+}
+
+func printSummary(summaries []tableSummary) {
+	fmt.Println("\nSummary:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, summary := range summaries {
+		line := fmt.Sprintf("  %s\t%d rows copied\tin %s", summary.table, summary.rows, summary.duration.Round(time.Millisecond))
+		if summary.purged {
+			line += fmt.Sprintf("\t%d rows purged", summary.rowsPurged)
+		}
+		if summary.verified != nil {
+			if *summary.verified {
+				line += "\tverified"
+			} else {
+				line += "\tVERIFICATION FAILED"
+			}
+		}
+		if len(summary.files) == 1 {
+			line += "\tinto 1 file"
+		} else if summary.files != nil {
+			line += fmt.Sprintf("\tinto %d files", len(summary.files))
+		}
+		fmt.Fprintln(w, line)
+		for _, file := range summary.files {
+			fmt.Fprintf(w, "    %s\n", file)
+		}
+	}
+	w.Flush()
+}
+
 func main() {
-	mysqlHost := pflag.StringP("host", "H", "localhost", "MySQL host")
-	mysqlPort := pflag.IntP("port", "P", 3306, "MySQL port")
-	mysqlUser := pflag.StringP("user", "u", "", "(required) MySQL user")
-	mysqlPassword := pflag.StringP("password", "p", "", "MySQL password")
+	pflag.StringP("host", "H", "localhost", "MySQL host")
+	pflag.IntP("port", "P", 3306, "MySQL port")
+	pflag.String("socket", "", "MySQL Unix socket, used when --host is localhost")
+	pflag.StringP("user", "u", "", "(required) MySQL user, unless given by --dsn or option file")
+	pflag.StringP("password", "p", "", "MySQL password. Prefer option file, MYSQL_PWD or --ask-password to keep it out of shell history.")
 	askPassword := pflag.Bool("ask-password", false, "Ask for MySQL password")
-	mysqlDatabase := pflag.StringP("database", "d", "", "(required) MySQL database")
-	mysqlTable := pflag.StringP("table", "t", "", "(required) MySQL table")
-	sqliteFile := pflag.StringP("output", "o", "", "(required) SQLite file to write to")
+	dsn := pflag.String("dsn", "", "MySQL DSN like user:password@tcp(host:3306)/database?param=value, overridden by the other connection flags")
+	defaultsFile := pflag.String("defaults-file", "", "Read [client] and [arklite] groups of this MySQL option file instead of ~/.my.cnf")
+	noDefaults := pflag.Bool("no-defaults", false, "Do not read ~/.my.cnf")
+	pflag.String("tls-mode", "", "TLS of MySQL connections: disabled, preferred, required or skip-verify (default disabled, required with --tls-ca or --tls-cert)")
+	pflag.String("tls-ca", "", "PEM file of CA certificates to verify MySQL server certificate with instead of system ones")
+	pflag.String("tls-cert", "", "PEM file of client certificate, needs --tls-key")
+	pflag.String("tls-key", "", "PEM file of client certificate key")
+	pflag.String("tls-server-name", "", "Host name MySQL server certificate must be issued for, when it differs from --host")
+	pflag.StringP("database", "d", "", "(required) MySQL database, unless given by --dsn or option file")
+	mysqlTables := pflag.StringArrayP("table", "t", []string{}, "(required) MySQL table, can be used multiple times. Accepts glob patterns and table:id_column overrides.")
+	sqliteFile := pflag.StringP("output", "o", "", "(required) SQLite file to write to, to verify or to restore from. May have {table}, {yyyy}, {mm}, {dd} and {n} placeholders to split the copy into shards.")
+	format := pflag.String("format", FormatSQLite, "Output format: sqlite, parquet, csv or jsonl. Formats other than SQLite write a file per table, named by {table} placeholder of --output.")
+	compression := pflag.String("compression", "", "Compression of Parquet files: snappy (default), gzip, zstd, lz4, brotli or none. Of CSV and JSON Lines files: none (default), gzip or zstd.")
+	binaryEncoding := pflag.String("binary-encoding", BinaryBase64, "Encoding of BLOB and BINARY values in CSV and JSON Lines files: base64 or hex")
+	csvNull := pflag.String("csv-null", "", "How CSV files write NULL values, e.g. \\N")
+	shardColumn := pflag.String("shard-column", "", "DATE, DATETIME or TIMESTAMP column which dates fill {yyyy}, {mm} and {dd} of --output")
+	shardRows := pflag.Uint64("shard-rows", 0, "Start the next {n} shard of --output after this many rows")
+	shardSize := pflag.String("shard-size", "", "Start the next {n} shard of --output once it grows to this size, e.g. 10GB")
 	forceOverwrite := pflag.BoolP("force", "f", false, "Force overwrite existing SQLite file")
-	idColumn := pflag.String("id-column", "id", "MySQL ID column to use for pagination and ordering")
+	resume := pflag.Bool("resume", false, "Resume an interrupted copy from the checkpoint stored in existing SQLite file")
+	appendRows := pflag.Bool("append", false, "Append rows after the largest id already archived to existing SQLite file")
+	idColumn := pflag.String("id-column", "", "MySQL ID column to use for pagination and ordering. Comma separated for composite keys. Detected from primary key or unique index when not set.")
+	allowUnindexed := pflag.Bool("allow-unindexed", false, "Allow pagination by id columns not covered by any index (every batch may scan the whole table)")
 	partition := pflag.String("partition", "", "MySQL partition to copy")
-	where := pflag.StringArray("where", []string{}, "MySQL WHERE clause, can be used multiple times")
+	where := pflag.StringArray("where", []string{}, "MySQL WHERE clause, can be used multiple times. NOW() and CURDATE() are in UTC when TIMESTAMP columns are copied. Evaluated by SQLite on restore.")
 	onlyColumns := pflag.String("only-columns", "", "Copy only these columns, comma separated. Conflicts with --exclude-columns.")
 	excludeColumns := pflag.String("exclude-columns", "", "Exclude these columns, comma separated. Conflicts with --only-columns.")
+	decimal := pflag.StringArray("decimal", []string{}, "Store DECIMAL columns as text, integer (scaled by 10^scale) or real. Accepts format, column=format or table.column=format, can be used multiple times.")
+	unsigned := pflag.StringArray("unsigned", []string{}, "Store BIGINT UNSIGNED columns as integer (fails on values above 2^63-1), text or blob. Accepts format, column=format or table.column=format, can be used multiple times.")
+	datetime := pflag.StringArray("datetime", []string{}, "Store DATE, DATETIME and TIMESTAMP columns as iso text, unix seconds or julian day numbers. Accepts format, column=format or table.column=format, can be used multiple times.")
+	zeroDate := pflag.String("zero-date", ZeroDateNull, "What to do with zero dates like 0000-00-00: null, keep (as text) or error")
+	datetimeZone := pflag.String("datetime-tz", "", "Time zone of DATETIME values, e.g. Europe/Berlin, to convert them to UTC. TIMESTAMP values are always read in UTC, with UTC session time zone.")
 	limit := pflag.Uint64("limit", 0, "Limit the number of rows to copy. 0 means no limit.")
+	purge := pflag.Bool("purge", false, "Delete copied rows from MySQL once they are committed to SQLite")
+	purgeChunkSize := pflag.Int("purge-chunk", 1000, "Number of rows to delete from MySQL with a single DELETE statement")
+	purgeSleep := pflag.Duration("purge-sleep", 0, "Time to sleep between DELETE statements, e.g. 100ms")
+	maxThreadsRunning := pflag.Int("max-threads-running", 0, "Pause reads and purges while Threads_running of MySQL is above this. 0 means no limit.")
+	maxReplicaLag := pflag.Duration("max-replica-lag", 0, "Pause reads and purges while any of --replica lags behind more than this, e.g. 10s")
+	replicaAddrs := pflag.StringArray("replica", []string{}, "Replica to check lag of, as host[:port] connected to with the same credentials or as user:password@tcp(host:port)/ DSN. Can be used multiple times.")
+	heartbeatTable := pflag.String("heartbeat-table", "", "Take replica lag from the ts column of this table, e.g. percona.heartbeat, instead of SHOW REPLICA STATUS")
+	throttleInterval := pflag.Duration("throttle-interval", time.Second, "How often to check the load while throttling")
+	maxRowsPerSec := pflag.Int64("max-rows-per-sec", 0, "Read at most this many rows per second from MySQL. 0 means no limit.")
+	maxBytesPerSec := pflag.String("max-bytes-per-sec", "", "Read at most this much data per second from MySQL, e.g. 10MB")
+	onConflict := pflag.String("on-conflict", OnConflictFail, "What restore does with rows already in MySQL: fail, ignore or replace")
+	restoreInto := pflag.String("restore-into", "", "MySQL table to restore into when it differs from the archived one")
+	verify := pflag.Bool("verify", false, "Verify copied data against MySQL after the copy is done")
+	verifyChunkSize := pflag.Int("verify-chunk", 10000, "Number of rows to compare with a single checksum when verifying")
 	writeBatchSize := pflag.Int("write-batch", 10000, "Write batch size")
-	readBatchSize := pflag.Int("read-batch", 100000, "Read batch size")
+	readBatchSize := pflag.Int("read-batch", 100000, "Read batch size, the first one with --batch-time")
+	batchTime := pflag.Duration("batch-time", 0, "Grow or shrink read batches so each of them takes about this long, e.g. 500ms")
+	minReadBatch := pflag.Int("min-read-batch", 100, "Smallest read batch size with --batch-time")
+	maxReadBatch := pflag.Int("max-read-batch", 1000000, "Largest read batch size with --batch-time")
+	strictSchema := pflag.Bool("strict-schema", false, "Fail if some NOT NULL, DEFAULT, CHECK or generated column can not be translated into SQLite instead of keeping it as a comment")
+	autoIncrement := pflag.Bool("autoincrement", false, "Declare single INTEGER primary key as AUTOINCREMENT in SQLite")
+	withoutRowid := pflag.Bool("without-rowid", false, "Create SQLite tables WITHOUT ROWID, useful for non-integer and composite primary keys")
+	indexes := pflag.Bool("indexes", false, "Recreate secondary indexes of MySQL tables in SQLite once the data is copied")
+	parallel := pflag.Int("parallel", 1, "Number of parallel readers, each reading its own range of ids or set of partitions")
 	noProgress := pflag.Bool("no-progress", false, "Do not show progress bar")
 	preview := pflag.Bool("preview", false, "Preview the SQL queries. Does not perform actual data copy.")
 	verbose := pflag.Bool("verbose", false, "Verbose output")
 	version := pflag.BoolP("version", "v", false, "Print version info")
 
 	pflag.CommandLine.SortFlags = false
+	pflag.Usage = usage
 
 	pflag.Parse()
 
+	cmd := "copy"
+	if pflag.NArg() > 0 {
+		cmd = pflag.Arg(0)
+	}
+	if pflag.NArg() > 1 || !slices.ContainsFunc(commands, func(c command) bool { return c.name == cmd }) {
+		pflag.Usage()
+		fmt.Printf("Unknown command: %s\n", strings.Join(pflag.Args(), " "))
+		os.Exit(1)
+	}
+
 	if *onlyColumns != "" && *excludeColumns != "" {
 		pflag.Usage()
 		fmt.Println("Conflicting flags: --only-columns and --exclude-columns. Only one can be used at a time.")
 		os.Exit(1)
 	}
 
-	if *askPassword {
-		if *mysqlPassword == "" {
-			fmt.Print("Enter password: ")
-			passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+	if *purgeChunkSize <= 0 {
+		pflag.Usage()
+		fmt.Println("--purge-chunk must be greater than 0")
+		os.Exit(1)
+	}
+
+	if *verifyChunkSize <= 0 {
+		pflag.Usage()
+		fmt.Println("--verify-chunk must be greater than 0")
+		os.Exit(1)
+	}
+
+	if *parallel <= 0 {
+		pflag.Usage()
+		fmt.Println("--parallel must be greater than 0")
+		os.Exit(1)
+	}
+
+	if cmd == "copy" && *parallel > 1 && *limit > 0 {
+		pflag.Usage()
+		fmt.Println("Conflicting flags: --parallel and --limit. Limited parallel readers would leave gaps in their ranges.")
+		os.Exit(1)
+	}
+
+	if *verify && *purge {
+		pflag.Usage()
+		fmt.Println("Conflicting flags: --verify and --purge. Purged rows can not be verified.")
+		os.Exit(1)
+	}
+
+	if (*maxReplicaLag > 0) != (len(*replicaAddrs) > 0) {
+		pflag.Usage()
+		fmt.Println("--max-replica-lag and --replica need each other")
+		os.Exit(1)
+	}
+
+	if *heartbeatTable != "" && len(*replicaAddrs) == 0 {
+		pflag.Usage()
+		fmt.Println("--heartbeat-table needs --replica to read it on")
+		os.Exit(1)
+	}
+
+	if *maxThreadsRunning < 0 || *maxReplicaLag < 0 || *throttleInterval <= 0 {
+		pflag.Usage()
+		fmt.Println("--max-threads-running and --max-replica-lag can not be negative, --throttle-interval must be greater than 0")
+		os.Exit(1)
+	}
+
+	rateLimit := RateLimit{RowsPerSec: *maxRowsPerSec}
+	if *maxRowsPerSec < 0 {
+		pflag.Usage()
+		fmt.Println("--max-rows-per-sec can not be negative")
+		os.Exit(1)
+	}
+	if *maxBytesPerSec != "" {
+		size, err := humanize.ParseBytes(*maxBytesPerSec)
+		if err != nil || size > math.MaxInt64 {
+			pflag.Usage()
+			fmt.Println("Bad --max-bytes-per-sec value:", *maxBytesPerSec)
+			os.Exit(1)
+		}
+		rateLimit.BytesPerSec = int64(size)
+	}
+
+	batchTiming := BatchTiming{Target: *batchTime, MinSize: *minReadBatch, MaxSize: *maxReadBatch}
+	if !batchTiming.Enabled() && (pflag.CommandLine.Changed("min-read-batch") || pflag.CommandLine.Changed("max-read-batch")) {
+		pflag.Usage()
+		fmt.Println("--min-read-batch and --max-read-batch need --batch-time")
+		os.Exit(1)
+	}
+	if err := batchTiming.Check(); err != nil {
+		pflag.Usage()
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if !slices.Contains(onConflictModes, *onConflict) {
+		pflag.Usage()
+		fmt.Printf("Bad --on-conflict value %q, expected one of %s\n", *onConflict, strings.Join(onConflictModes, ", "))
+		os.Exit(1)
+	}
+
+	if *forceOverwrite && *resume {
+		pflag.Usage()
+		fmt.Println("Conflicting flags: --force and --resume. Only one can be used at a time.")
+		os.Exit(1)
+	}
+
+	if *appendRows && (*forceOverwrite || *resume) {
+		pflag.Usage()
+		fmt.Println("Conflicting flags: --append can not be combined with --force or --resume.")
+		os.Exit(1)
+	}
+
+	if !slices.Contains(outputFormats, *format) {
+		pflag.Usage()
+		fmt.Printf("Bad --format value %q, expected one of %s\n", *format, strings.Join(outputFormats, ", "))
+		os.Exit(1)
+	}
+	fileOpts := FileOptions{
+		Format:      *format,
+		Compression: *compression,
+		BatchSize:   *writeBatchSize,
+		Null:        *csvNull,
+		Binary:      *binaryEncoding,
+	}
+	if *format == FormatSQLite && *compression != "" {
+		pflag.Usage()
+		fmt.Println("--compression needs --format other than sqlite")
+		os.Exit(1)
+	}
+	if *format != FormatCSV && *format != FormatJSONL && (pflag.CommandLine.Changed("binary-encoding") || pflag.CommandLine.Changed("csv-null")) {
+		pflag.Usage()
+		fmt.Println("--binary-encoding and --csv-null need --format csv or jsonl")
+		os.Exit(1)
+	}
+	if *format != FormatSQLite {
+		if err := fileOpts.Check(); err != nil {
+			pflag.Usage()
+			fmt.Println("Bad output options:", err)
+			os.Exit(1)
+		}
+	}
+	if *format != FormatSQLite {
+		if cmd != "copy" {
+			pflag.Usage()
+			fmt.Printf("--format %s is only supported by copy, %s works with SQLite files.\n", *format, cmd)
+			os.Exit(1)
+		}
+		if *resume || *appendRows || *purge || *verify || *indexes {
+			pflag.Usage()
+			fmt.Printf("Conflicting flags: --format %s can not be combined with --resume, --append, --purge, --verify or --indexes.\n", *format)
+			os.Exit(1)
+		}
+		if len(*decimal) > 0 || len(*unsigned) > 0 || len(*datetime) > 0 || *autoIncrement || *withoutRowid {
+			pflag.Usage()
+			fmt.Println("--decimal, --unsigned, --datetime, --autoincrement and --without-rowid only apply to SQLite output.")
+			os.Exit(1)
+		}
+		if *shardColumn != "" || *shardRows > 0 || *shardSize != "" || OutputTemplate(strings.ReplaceAll(*sqliteFile, "{table}", "")).Sharded() {
+			pflag.Usage()
+			fmt.Printf("--format %s only supports {table} placeholder of --output, sharding needs SQLite output.\n", *format)
+			os.Exit(1)
+		}
+	}
+
+	var shardOpts *ShardOptions
+	if *format == FormatSQLite && OutputTemplate(*sqliteFile).Sharded() || *shardColumn != "" || *shardRows > 0 || *shardSize != "" {
+		shardOpts = &ShardOptions{
+			Template: OutputTemplate(*sqliteFile),
+			Column:   *shardColumn,
+			MaxRows:  *shardRows,
+			Force:    *forceOverwrite,
+			Created:  map[string]bool{},
+			Config:   sqliteConfigQuery,
+			Durable:  *purge,
+			Indexes:  *indexes,
+		}
+		if *shardSize != "" {
+			size, err := humanize.ParseBytes(*shardSize)
 			if err != nil {
-				fmt.Println("Error reading password:", err)
+				pflag.Usage()
+				fmt.Println("Bad --shard-size value:", err)
 				os.Exit(1)
 			}
-			fmt.Println() // Print newline after password input
-			*mysqlPassword = string(passwordBytes)
+			shardOpts.MaxBytes = size
+		}
+		if cmd != "copy" {
+			pflag.Usage()
+			fmt.Printf("Sharded output is only supported by copy, %s needs --output of a single file.\n", cmd)
+			os.Exit(1)
+		}
+		if err := shardOpts.Check(); err != nil {
+			pflag.Usage()
+			fmt.Println("Bad sharding options:", err)
+			os.Exit(1)
+		}
+		if *resume || *appendRows || *verify {
+			pflag.Usage()
+			fmt.Println("Conflicting flags: sharded output can not be combined with --resume, --append or --verify.")
+			os.Exit(1)
 		}
 	}
 
@@ -129,47 +680,180 @@ func main() {
 		slog.SetLogLoggerLevel(slog.LevelInfo)
 	}
 
-	if *mysqlDatabase == "" || *mysqlTable == "" || *sqliteFile == "" || *mysqlUser == "" {
+	if cmd == "info" {
+		if *sqliteFile == "" {
+			pflag.Usage()
+			fmt.Println("Required flags are missing:\n  --output, -o <file>")
+			os.Exit(1)
+		}
+		if err := printInfo(*sqliteFile, *mysqlTables); err != nil {
+			slog.Error("Error reading manifest", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *defaultsFile != "" && *noDefaults {
+		pflag.Usage()
+		fmt.Println("Conflicting flags: --defaults-file and --no-defaults")
+		os.Exit(1)
+	}
+	// Connection settings in order of precedence, from the lowest
+	var optionFile connectionSettings
+	var err error
+	if *defaultsFile != "" {
+		optionFile, err = readOptionFile(*defaultsFile)
+	} else if !*noDefaults {
+		optionFile, err = defaultOptionFile()
+	}
+	if err != nil {
+		slog.Error("Error reading option file", "error", err)
+		os.Exit(1)
+	}
+	var dsnConnection connectionSettings
+	var dsnConfig *mysql.Config
+	if *dsn != "" {
+		if dsnConnection, dsnConfig, err = dsnSettings(*dsn); err != nil {
+			pflag.Usage()
+			fmt.Println("Bad --dsn value:", err)
+			os.Exit(1)
+		}
+	}
+	connection := mergeSettings(envSettings(), optionFile, dsnConnection, flagSettings(pflag.CommandLine))
+
+	if connection["database"] == "" || len(*mysqlTables) == 0 || *sqliteFile == "" || connection["user"] == "" {
 		pflag.Usage()
 		fmt.Println("Required flags are missing:")
-		if *mysqlDatabase == "" {
+		if connection["database"] == "" {
 			fmt.Println("  --database, -d <database>")
 		}
-		if *mysqlTable == "" {
+		if len(*mysqlTables) == 0 {
 			fmt.Println("  --table, -t <table>")
 		}
 		if *sqliteFile == "" {
 			fmt.Println("  --output, -o <file>")
 		}
-		if *mysqlUser == "" {
+		if connection["user"] == "" {
 			fmt.Println("  --user, -u <user>")
 		}
 		os.Exit(1)
 	}
 
-	mysqlConfig := &mysql.Config{
-		User:                 *mysqlUser,
-		Passwd:               *mysqlPassword,
-		Net:                  "tcp",
-		Addr:                 fmt.Sprintf("%s:%d", *mysqlHost, *mysqlPort),
-		DBName:               *mysqlDatabase,
-		ParseTime:            true,
-		AllowNativePasswords: true,
+	tlsOpts := connection.tlsOptions()
+	if err := tlsOpts.Check(); err != nil {
+		pflag.Usage()
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
-	mysqlDb, err := sql.Open("mysql", mysqlConfig.FormatDSN())
+	if *askPassword && !pflag.CommandLine.Changed("password") {
+		fmt.Print("Enter password: ")
+		passwordBytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			fmt.Println("Error reading password:", err)
+			os.Exit(1)
+		}
+		fmt.Println() // Print newline after password input
+		connection["password"] = string(passwordBytes)
+	}
+
+	var idColumns []string
+	if *idColumn != "" {
+		var err error
+		idColumns, err = parseIdColumns(*idColumn)
+		if err != nil {
+			pflag.Usage()
+			fmt.Println("Bad --id-column value:", err)
+			os.Exit(1)
+		}
+	}
+
+	decimalFormat, err := parseColumnFormats(*decimal, decimalFormats, DecimalText)
 	if err != nil {
-		slog.Error("Error connecting to MySQL", "error", err)
+		pflag.Usage()
+		fmt.Println("Bad --decimal value:", err)
+		os.Exit(1)
+	}
+	unsignedFormat, err := parseColumnFormats(*unsigned, unsignedFormats, UnsignedInteger)
+	if err != nil {
+		pflag.Usage()
+		fmt.Println("Bad --unsigned value:", err)
 		os.Exit(1)
 	}
-	defer mysqlDb.Close()
+	datetimeFormat, err := parseColumnFormats(*datetime, datetimeFormats, DatetimeISO)
+	if err != nil {
+		pflag.Usage()
+		fmt.Println("Bad --datetime value:", err)
+		os.Exit(1)
+	}
+	if !slices.Contains(zeroDateModes, *zeroDate) {
+		pflag.Usage()
+		fmt.Printf("Bad --zero-date value %q, expected one of %s\n", *zeroDate, strings.Join(zeroDateModes, ", "))
+		os.Exit(1)
+	}
+	var datetimeLocation *time.Location
+	if *datetimeZone != "" {
+		datetimeLocation, err = time.LoadLocation(*datetimeZone)
+		if err != nil {
+			pflag.Usage()
+			fmt.Println("Bad --datetime-tz value:", err)
+			os.Exit(1)
+		}
+	}
+	typeMapping := TypeMapping{
+		Decimal:      decimalFormat,
+		Unsigned:     unsignedFormat,
+		Datetime:     datetimeFormat,
+		ZeroDate:     *zeroDate,
+		DatetimeZone: datetimeLocation,
+	}
 
-	// Test connection
-	if err := mysqlDb.Ping(); err != nil {
-		slog.Error("Error pinging MySQL", "error", err)
+	tableSpecs, err := parseTableSpecs(*mysqlTables, idColumns)
+	if err != nil {
+		pflag.Usage()
+		fmt.Println("Bad --table value:", err)
 		os.Exit(1)
 	}
 
+	mysqlConfig, err := connection.mysqlConfig(dsnConfig)
+	if err != nil {
+		pflag.Usage()
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := tlsOpts.Apply(mysqlConfig); err != nil {
+		slog.Error("Error setting up TLS", "error", err)
+		os.Exit(1)
+	}
+
+	if cmd == "restore" {
+		// Archived TIMESTAMP values are in UTC, --where of restore is evaluated by SQLite
+		mysqlConfig = utcSession(mysqlConfig)
+	}
+	mysqlDb, err := openMySQL(mysqlConfig)
+	if err != nil {
+		slog.Error("Error connecting to MySQL", "error", err)
+		os.Exit(1)
+	}
+	// The connection is reopened in UTC when TIMESTAMP columns are copied
+	defer func() { mysqlDb.Close() }()
+
+	if cmd == "restore" {
+		err := restoreArchive(mysqlDb, *sqliteFile, tableSpecs, RestorerOptions{
+			Target:       *restoreInto,
+			BatchSize:    *writeBatchSize,
+			Limit:        *limit,
+			OnConflict:   *onConflict,
+			Where:        *where,
+			DatetimeZone: datetimeLocation,
+		}, *noProgress)
+		if err != nil {
+			slog.Error("Error restoring data", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var onlyColumnsArray []string
 	var excludeColumnsArray []string
 
@@ -178,62 +862,320 @@ func main() {
 		for i, column := range onlyColumnsArray {
 			onlyColumnsArray[i] = strings.TrimSpace(column)
 		}
-
-		if !slices.Contains(onlyColumnsArray, *idColumn) {
-			slog.Error("ID column not found in --only-columns", "id-column", *idColumn, "available-columns", strings.Join(onlyColumnsArray, ", "))
-			os.Exit(1)
-		}
-
 	} else if *excludeColumns != "" {
 		excludeColumnsArray = strings.Split(*excludeColumns, ",")
 		for i, column := range excludeColumnsArray {
 			excludeColumnsArray[i] = strings.TrimSpace(column)
-			if excludeColumnsArray[i] == *idColumn {
-				slog.Error("Can not exclude ID column", "id-column", *idColumn, "excluded-columns", strings.Join(excludeColumnsArray, ", "))
+		}
+	}
+
+	tableSpecs, err = expandTableSpecs(mysqlDb, tableSpecs)
+	if err != nil {
+		slog.Error("Error listing tables", "error", err)
+		os.Exit(1)
+	}
+
+	schemas := make([]*Schema, 0, len(tableSpecs))
+	for _, spec := range tableSpecs {
+		if len(spec.IdColumns) == 0 {
+			spec.IdColumns, err = DetectIdColumns(mysqlDb, spec.Name)
+			if err != nil {
+				slog.Error("Can not detect id columns", "table", spec.Name, "error", err)
 				os.Exit(1)
 			}
+			slog.Info("Detected id columns", "table", spec.Name, "id-columns", strings.Join(spec.IdColumns, ", "))
+		}
+
+		for _, idColumn := range spec.IdColumns {
+			if len(onlyColumnsArray) > 0 && !slices.Contains(onlyColumnsArray, idColumn) {
+				slog.Error("ID column not found in --only-columns", "table", spec.Name, "id-column", idColumn, "available-columns", strings.Join(onlyColumnsArray, ", "))
+				os.Exit(1)
+			}
+			if slices.Contains(excludeColumnsArray, idColumn) {
+				slog.Error("Can not exclude ID column", "table", spec.Name, "id-column", idColumn, "excluded-columns", strings.Join(excludeColumnsArray, ", "))
+				os.Exit(1)
+			}
+		}
+
+		schema, err := ReadSchema(mysqlDb, spec.Name, *partition, *where, spec.IdColumns, onlyColumnsArray, excludeColumnsArray, typeMapping)
+		if err != nil {
+			slog.Error("Error reading schema", "table", spec.Name, "error", err)
+			os.Exit(1)
+		}
+		if schema.IdIndex == nil && !*allowUnindexed {
+			slog.Error(
+				"Leading id column is not indexed, every batch would scan the whole table. Use --allow-unindexed to proceed anyway",
+				"table", spec.Name, "id-columns", strings.Join(schema.IdColumns, ", "),
+			)
+			os.Exit(1)
+		}
+		if *purge && !schema.UniqueIds() {
+			slog.Error(
+				"Can not purge by id columns which are not the primary key or a unique index over NOT NULL columns, rows never copied could be deleted",
+				"table", spec.Name, "id-columns", strings.Join(schema.IdColumns, ", "),
+			)
+			os.Exit(1)
+		}
+		if schema.IdIndex == nil || schema.IdIndex.covers(schema.IdColumns) < len(schema.IdColumns) {
+			slog.Warn("Id columns are not fully indexed, reads may be slow", "table", spec.Name, "id-columns", strings.Join(schema.IdColumns, ", "), "index", schema.IdIndexDescription())
+		}
+		schema.AutoIncrement = *autoIncrement
+		schema.WithoutRowid = *withoutRowid
+		if err := schema.CheckSQLiteTable(); err != nil {
+			slog.Error("Bad SQLite table options", "table", spec.Name, "error", err)
+			os.Exit(1)
+		}
+		if cmd != "verify" && *format == FormatSQLite {
+			for _, untranslated := range schema.SQLiteUntranslated() {
+				if *strictSchema {
+					slog.Error("Can not translate to SQLite", "table", spec.Name, "constraint", untranslated)
+					os.Exit(1)
+				}
+				slog.Warn("Can not translate to SQLite, keeping it as a comment", "table", spec.Name, "constraint", untranslated)
+			}
 		}
+		schemas = append(schemas, schema)
 	}
 
-	schema, err := ReadSchema(mysqlDb, *mysqlTable, *partition, *where, *idColumn, onlyColumnsArray, excludeColumnsArray)
-	if err != nil {
-		slog.Error("Error reading schema", "error", err)
+	if slices.ContainsFunc(schemas, (*Schema).HasTimestamp) {
+		if len(*where) > 0 {
+			slog.Warn("TIMESTAMP columns are read in UTC session time zone, so NOW() and CURDATE() of --where are in UTC too")
+		}
+		mysqlConfig = utcSession(mysqlConfig)
+		mysqlDb.Close()
+		if mysqlDb, err = openMySQL(mysqlConfig); err != nil {
+			slog.Error("Error connecting to MySQL", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *format != FormatSQLite && len(schemas) > 1 && !strings.Contains(*sqliteFile, "{table}") {
+		pflag.Usage()
+		fmt.Printf("--format %s writes a file per table, --output needs {table} placeholder to copy %d tables.\n", *format, len(schemas))
 		os.Exit(1)
 	}
 
+	verifierOpts := VerifierOptions{
+		ChunkSize: *verifyChunkSize,
+	}
+
+	if cmd == "verify" {
+		if _, err := os.Stat(*sqliteFile); err != nil {
+			slog.Error("Can not verify SQLite file", "error", err)
+			os.Exit(1)
+		}
+		sqliteDb, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", *sqliteFile))
+		if err != nil {
+			slog.Error("Error opening SQLite file", "error", err)
+			os.Exit(1)
+		}
+		defer sqliteDb.Close()
+
+		allOk := true
+		for _, schema := range schemas {
+			verifierOpts.Progress = newProgress(*noProgress, fmt.Sprintf("Verifying %s", schema.Table))
+			if verifierOpts.UpTo, err = limitedUpTo(mysqlDb, sqliteDb, schema, *limit); err != nil {
+				slog.Error("Error verifying data", "table", schema.Table, "error", err)
+				os.Exit(1)
+			}
+			ok, err := verifyArchive(mysqlDb, sqliteDb, schema, verifierOpts)
+			if err != nil {
+				slog.Error("Error verifying data", "table", schema.Table, "error", err)
+				os.Exit(1)
+			}
+			allOk = allOk && ok
+		}
+		if !allOk {
+			os.Exit(1)
+		}
+		return
+	}
+
 	if *preview {
 		fmt.Println("Queries to be executed:")
-		createTableQuery := schema.SQLiteCreateTableQuery()
-		selectQuery := schema.MySQLSelectQuery(int64(*readBatchSize))
-		fmt.Printf(
-			"\nWill create sqlite table in %s with:\n%s\n\n",
-			*sqliteFile, createTableQuery,
-		)
-		fmt.Printf("Will select data from MySQL with:\n%s\n", selectQuery)
-
-		insertQuery := schema.SqliteInsertQuery()
-		fmt.Printf("Will insert data into SQLite with:\n%s\n", insertQuery)
-
-		fmt.Printf(
-			"Reads in batches of %d rows from MySQL and writes to SQLite in batches of %d rows.\n",
-			*readBatchSize, *writeBatchSize,
-		)
+		for _, schema := range schemas {
+			fmt.Printf("\n--- Table %s (id columns %s, %s) ---\n", schema.Table, strings.Join(schema.IdColumns, ", "), schema.IdIndexDescription())
+			createTableQuery := schema.SQLiteCreateTableQuery()
+			selectQuery := schema.MySQLSelectQuery(int64(*readBatchSize), true)
+			if idIndexQuery := schema.SQLiteCreateIdIndexQuery(); idIndexQuery != "" {
+				createTableQuery += ";\n" + idIndexQuery
+			}
+			if *format == FormatParquet {
+				fmt.Printf(
+					"\nWill write Parquet file %s with %s compression and schema:\n%s\n\n",
+					strings.ReplaceAll(*sqliteFile, "{table}", schema.Table), fileOpts.Compression, ParquetSchema(schema),
+				)
+			} else if *format != FormatSQLite {
+				path := strings.ReplaceAll(*sqliteFile, "{table}", schema.Table)
+				sidecar, err := json.MarshalIndent(NewTextSchema(schema, fileOpts), "", "  ")
+				if err != nil {
+					slog.Error("Error describing columns", "table", schema.Table, "error", err)
+					os.Exit(1)
+				}
+				fmt.Printf(
+					"\nWill write %s file %s with %s compression and columns described in %s.schema.json:\n%s\n\n",
+					strings.ToUpper(*format), path, fileOpts.Compression, path, sidecar,
+				)
+			} else {
+				fmt.Printf(
+					"\nWill create sqlite table in %s with:\n%s\n\n",
+					*sqliteFile, createTableQuery,
+				)
+			}
+			if *parallel > 1 {
+				ranges, err := planRanges(mysqlDb, schema, *parallel)
+				if err != nil {
+					slog.Error("Error planning read ranges", "table", schema.Table, "error", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Will read in %d parallel ranges:\n", len(ranges))
+				for _, r := range ranges {
+					fmt.Printf("  %s\n", r)
+				}
+				selectQuery = schema.MySQLSelectRangeQuery(int64(*readBatchSize), true, ranges[len(ranges)/2])
+			}
+			fmt.Printf("Will select data from MySQL with:\n%s\n", selectQuery)
+			fmt.Printf("First batch is selected without id columns condition.\n")
+
+			if *format == FormatSQLite {
+				insertQuery := schema.SqliteInsertQuery()
+				fmt.Printf("Will insert data into SQLite with:\n%s\n", insertQuery)
+			}
+
+			if *indexes {
+				sqliteIndexes := schema.SQLiteIndexes()
+				if len(sqliteIndexes) == 0 {
+					fmt.Printf("\nNo secondary indexes to create.\n")
+				} else {
+					fmt.Printf("\nWill create indexes once the data is copied with:\n")
+				}
+				for _, index := range sqliteIndexes {
+					fmt.Println(schema.SQLiteCreateIndexQuery(index))
+				}
+			}
+
+			if *purge {
+				deleteQuery := schema.MySQLDeleteQuery(*purgeChunkSize)
+				fmt.Printf(
+					"\nWill delete copied rows from MySQL in chunks of %d rows with:\n%s\n",
+					*purgeChunkSize, deleteQuery,
+				)
+				if *purgeSleep > 0 {
+					fmt.Printf("Sleeping %s between chunks.\n", *purgeSleep)
+				}
+			}
+		}
+
+		if *format == FormatParquet {
+			fmt.Printf(
+				"\nReads in batches of %d rows from MySQL and writes a Parquet row group of every %d rows.\n",
+				*readBatchSize, *writeBatchSize,
+			)
+		} else if *format != FormatSQLite {
+			fmt.Printf(
+				"\nReads in batches of %d rows from MySQL and writes to %s file in batches of %d rows.\n",
+				*readBatchSize, strings.ToUpper(*format), *writeBatchSize,
+			)
+		} else {
+			fmt.Printf(
+				"\nReads in batches of %d rows from MySQL and writes to SQLite in batches of %d rows.\n",
+				*readBatchSize, *writeBatchSize,
+			)
+		}
+		if batchTiming.Enabled() {
+			fmt.Printf(
+				"Read batches grow or shrink to take about %s, between %d and %d rows.\n",
+				batchTiming.Target, batchTiming.MinSize, batchTiming.MaxSize,
+			)
+		}
+		if shardOpts != nil {
+			fmt.Printf("Splits the output into shard files of %s.\n", shardOpts.Template)
+		}
+		if *maxThreadsRunning > 0 {
+			fmt.Printf("Pauses while Threads_running is above %d.\n", *maxThreadsRunning)
+		}
+		if *maxReplicaLag > 0 {
+			fmt.Printf("Pauses while any of %s lags behind more than %s.\n", strings.Join(*replicaAddrs, ", "), *maxReplicaLag)
+		}
+		if rateLimit.RowsPerSec > 0 {
+			fmt.Printf("Reads at most %d rows per second.\n", rateLimit.RowsPerSec)
+		}
+		if rateLimit.BytesPerSec > 0 {
+			fmt.Printf("Reads at most %s per second.\n", humanize.Bytes(uint64(rateLimit.BytesPerSec)))
+		}
 		os.Exit(0)
 	}
 
-	if _, err := os.Stat(*sqliteFile); err == nil {
-		if !*forceOverwrite {
-			slog.Error("SQLite file already exists, use --force to overwrite")
+	var throttler *Throttler
+	if *maxThreadsRunning > 0 || *maxReplicaLag > 0 {
+		replicas, err := connectReplicas(*replicaAddrs, mysqlConfig)
+		if err != nil {
+			slog.Error("Error connecting to replica", "error", err)
 			os.Exit(1)
 		}
-		err = os.Remove(*sqliteFile)
-		if err != nil {
-			slog.Error("Error removing existing SQLite file", "error", err)
+		for _, replica := range replicas {
+			defer replica.Db.Close()
+		}
+		throttler = NewThrottler(mysqlDb, replicas, ThrottleOptions{
+			MaxThreadsRunning: *maxThreadsRunning,
+			MaxReplicaLag:     *maxReplicaLag,
+			HeartbeatTable:    *heartbeatTable,
+			Interval:          *throttleInterval,
+		})
+	}
+
+	if *format != FormatSQLite {
+		copyFiles(mysqlDb, schemas, *sqliteFile, fileOpts, *forceOverwrite, CopierOptions{
+			WriteBatchSize: *writeBatchSize,
+			ReadBatchSize:  *readBatchSize,
+			Limit:          *limit,
+			Parallel:       *parallel,
+			Throttler:      throttler,
+			RateLimit:      rateLimit,
+			BatchTiming:    batchTiming,
+		}, *noProgress)
+		return
+	}
+
+	if shardOpts != nil {
+		shardOpts.Host = mysqlConfig.Addr
+		shardOpts.Database = mysqlConfig.DBName
+		copyShards(mysqlDb, schemas, *shardOpts, CopierOptions{
+			WriteBatchSize: *writeBatchSize,
+			ReadBatchSize:  *readBatchSize,
+			Limit:          *limit,
+			Purge:          *purge,
+			PurgeChunkSize: *purgeChunkSize,
+			PurgeSleep:     *purgeSleep,
+			Parallel:       *parallel,
+			Throttler:      throttler,
+			RateLimit:      rateLimit,
+			BatchTiming:    batchTiming,
+		}, *noProgress)
+		return
+	}
+
+	resuming := false
+	if _, err := os.Stat(*sqliteFile); err == nil {
+		if *appendRows {
+			slog.Info("Appending to existing SQLite file", "file", *sqliteFile)
+		} else if *resume {
+			resuming = true
+		} else if !*forceOverwrite {
+			slog.Error("SQLite file already exists, use --force to overwrite or --resume to continue")
 			os.Exit(1)
+		} else {
+			err = os.Remove(*sqliteFile)
+			if err != nil {
+				slog.Error("Error removing existing SQLite file", "error", err)
+				os.Exit(1)
+			}
 		}
+	} else if *resume || *appendRows {
+		slog.Info("SQLite file does not exist yet, starting a new one", "file", *sqliteFile)
 	}
 
-	sqliteDb, err := sql.Open("sqlite3", *sqliteFile)
+	sqliteDb, err := sql.Open("sqlite3", sqliteDSN(*sqliteFile, *purge))
 	if err != nil {
 		slog.Error("Error opening SQLite file", "error", err)
 		os.Exit(1)
@@ -246,45 +1188,112 @@ func main() {
 		os.Exit(1)
 	}
 
-	var progress ProgressRenderer
-	if *noProgress {
-		progress = &NoopProgressBar{}
-	} else {
-		progress = progressbar.NewOptions64(
-			-1,
-			progressbar.OptionSetDescription("Copying rows"),
-			progressbar.OptionFullWidth(),
-			progressbar.OptionShowIts(),
-			progressbar.OptionSetItsString("rows"),
-			progressbar.OptionShowCount(),
-			progressbar.OptionUseANSICodes(true),
-			progressbar.OptionThrottle(time.Second),
-			progressbar.OptionSetElapsedTime(true),
-			progressbar.OptionSetPredictTime(true),
-			progressbar.OptionOnCompletion(func() {
-				fmt.Fprint(os.Stderr, "\n")
-			}),
-			progressbar.OptionSetWriter(os.Stderr),
-		)
-	}
-
-	copierOpts := CopierOptions{
-		WriteBatchSize: *writeBatchSize,
-		ReadBatchSize:  *readBatchSize,
-		Limit:          *limit,
-		Progress:       progress,
-	}
-	copier := NewCopier(mysqlDb, sqliteDb, schema, copierOpts)
-
-	err = copier.CreateTable()
-	if err != nil {
-		slog.Error("Error creating table", "error", err)
-		os.Exit(1)
+	summaries := make([]tableSummary, 0, len(schemas))
+	allVerified := true
+	for _, schema := range schemas {
+		copyStartAt := time.Now()
+		copierOpts := CopierOptions{
+			WriteBatchSize: *writeBatchSize,
+			ReadBatchSize:  *readBatchSize,
+			Limit:          *limit,
+			Resume:         resuming,
+			Append:         *appendRows,
+			Purge:          *purge,
+			PurgeChunkSize: *purgeChunkSize,
+			PurgeSleep:     *purgeSleep,
+			Parallel:       *parallel,
+			Throttler:      throttler,
+			RateLimit:      rateLimit,
+			BatchTiming:    batchTiming,
+			Progress:       newProgress(*noProgress, fmt.Sprintf("Copying %s", schema.Table)),
+		}
+		copier := NewCopier(mysqlDb, sqliteDb, schema, copierOpts)
+
+		err = copier.CreateTable()
+		if err != nil {
+			slog.Error("Error creating table", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		err = copier.InitCheckpoint()
+		if err != nil {
+			slog.Error("Error initializing checkpoint", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		manifest := NewManifest(schema, mysqlConfig.Addr, mysqlConfig.DBName)
+		if err := startManifest(sqliteDb, manifest); err != nil {
+			slog.Error("Error writing manifest", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		mode := RunCopy
+		if *appendRows {
+			mode = RunAppend
+		} else if resuming {
+			mode = RunResume
+		}
+		appendedAfter, err := schema.SqliteKey(copier.AppendedAfter())
+		if err != nil {
+			slog.Error("Error writing history", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		run, err := startRun(sqliteDb, schema, mode, appendedAfter)
+		if err != nil {
+			slog.Error("Error writing history", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		err = copier.Copy()
+		if err != nil {
+			slog.Error("Error copying data", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		err = copier.Wait()
+		if err != nil {
+			slog.Error("Error writing to SQLite", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		if *indexes {
+			if err := copier.CreateIndexes(); err != nil {
+				slog.Error("Error creating indexes", "table", schema.Table, "error", err)
+				os.Exit(1)
+			}
+		}
+		if err := finishManifest(sqliteDb, schema, manifest); err != nil {
+			slog.Error("Error writing manifest", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+		if err := finishRun(sqliteDb, run, manifest.MaxId, copier.RowsWritten()); err != nil {
+			slog.Error("Error writing history", "table", schema.Table, "error", err)
+			os.Exit(1)
+		}
+
+		summary := tableSummary{
+			table:      schema.Table,
+			rows:       copier.RowsWritten(),
+			rowsPurged: copier.RowsPurged(),
+			duration:   time.Since(copyStartAt),
+			purged:     *purge,
+		}
+
+		if *verify {
+			verifierOpts.Progress = newProgress(*noProgress, fmt.Sprintf("Verifying %s", schema.Table))
+			// Rows archived before are not necessarily in MySQL any more
+			verifierOpts.After = copier.AppendedAfter()
+			if verifierOpts.UpTo, err = limitedUpTo(mysqlDb, sqliteDb, schema, *limit); err != nil {
+				slog.Error("Error verifying data", "table", schema.Table, "error", err)
+				os.Exit(1)
+			}
+			ok, err := verifyArchive(mysqlDb, sqliteDb, schema, verifierOpts)
+			if err != nil {
+				slog.Error("Error verifying data", "table", schema.Table, "error", err)
+				os.Exit(1)
+			}
+			summary.verified = &ok
+			allVerified = allVerified && ok
+		}
+		summaries = append(summaries, summary)
 	}
-	err = copier.Copy()
-	if err != nil {
-		slog.Error("Error copying data", "error", err)
+
+	printSummary(summaries)
+	if !allVerified {
 		os.Exit(1)
 	}
-	copier.Wait()
 }
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	buildInfo "github.com/bak1an/arklite/version"
+)
+
+// _arklite_meta tells where the data of every table came from and how it was copied.
+const sqliteCreateManifestTableQuery = `
+CREATE TABLE IF NOT EXISTS "_arklite_meta" (
+  "table_name" TEXT PRIMARY KEY,
+  "source_host" TEXT NOT NULL,
+  "source_database" TEXT NOT NULL,
+  "partition_name" TEXT NOT NULL,
+  "where_clauses" TEXT NOT NULL,
+  "id_columns" TEXT NOT NULL,
+  "columns" TEXT NOT NULL,
+  "min_id" TEXT,
+  "max_id" TEXT,
+  "rows_copied" INTEGER NOT NULL,
+  "started_at" TEXT NOT NULL,
+  "finished_at" TEXT,
+  "arklite_version" TEXT NOT NULL,
+  "mysql_create_table" TEXT NOT NULL
+)`
+
+const sqliteReplaceManifestQuery = `
+INSERT OR REPLACE INTO "_arklite_meta" (
+  "table_name", "source_host", "source_database", "partition_name", "where_clauses", "id_columns", "columns",
+  "min_id", "max_id", "rows_copied", "started_at", "finished_at", "arklite_version", "mysql_create_table"
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+const sqliteSelectManifestsQuery = `
+SELECT
+  "table_name", "source_host", "source_database", "partition_name", "where_clauses", "id_columns", "columns",
+  "min_id", "max_id", "rows_copied", "started_at", "finished_at", "arklite_version", "mysql_create_table"
+FROM "_arklite_meta"`
+
+// Manifest describes the source and the run which produced a table of the archive.
+type Manifest struct {
+	Table     string
+	Host      string
+	Database  string
+	Partition string
+	Where     []string
+	IdColumns []string
+	Columns   []ManifestColumn
+	// MinId and MaxId are the id range copied, as the ids are stored in SQLite
+	MinId      Cursor
+	MaxId      Cursor
+	RowsCopied uint64
+	StartedAt  time.Time
+	// FinishedAt is zero until the copy is done
+	FinishedAt time.Time
+	Version    buildInfo.BuildInfo
+	// CreateTable is the original MySQL table definition
+	CreateTable string
+}
+
+type ManifestColumn struct {
+	Name      string `json:"name"`
+	MySQLType string `json:"mysql_type"`
+}
+
+func NewManifest(s *Schema, host, database string) *Manifest {
+	columns := make([]ManifestColumn, len(s.Columns))
+	for i, column := range s.Columns {
+		mysqlType := column.columnType
+		if mysqlType == "" {
+			mysqlType = column.mysqlType
+		}
+		columns[i] = ManifestColumn{Name: column.name, MySQLType: mysqlType}
+	}
+	where := s.Where
+	if where == nil {
+		where = []string{}
+	}
+	return &Manifest{
+		Table:       s.Table,
+		Host:        host,
+		Database:    database,
+		Partition:   s.Partition,
+		Where:       where,
+		IdColumns:   s.IdColumns,
+		Columns:     columns,
+		StartedAt:   time.Now().UTC(),
+		Version:     buildInfo.GetBuildInfo(),
+		CreateTable: s.CreateTable,
+	}
+}
+
+// startManifest records the run in the output file. Resumed runs keep the time the copy was started at.
+func startManifest(db *sql.DB, m *Manifest) error {
+	if _, err := db.Exec(sqliteCreateManifestTableQuery); err != nil {
+		return err
+	}
+	previous, err := readManifest(db, m.Table)
+	if err != nil {
+		return err
+	}
+	if previous != nil && previous.FinishedAt.IsZero() {
+		m.StartedAt = previous.StartedAt
+	}
+	return writeManifest(db, m)
+}
+
+// finishManifest records the id range and the number of rows copied once the copy is done.
+func finishManifest(db *sql.DB, s *Schema, m *Manifest) error {
+	var err error
+	if m.MinId, err = sqliteIdBound(db, s, false); err != nil {
+		return err
+	}
+	if m.MaxId, err = sqliteIdBound(db, s, true); err != nil {
+		return err
+	}
+	checkpoint, err := readCheckpoint(db, s.Table)
+	if err != nil {
+		return err
+	}
+	if checkpoint != nil {
+		m.RowsCopied = checkpoint.RowsCopied
+	}
+	m.FinishedAt = time.Now().UTC()
+	return writeManifest(db, m)
+}
+
+// sqliteIdBound returns ids of the first or the last row of SQLite table, nil when it is empty.
+func sqliteIdBound(db *sql.DB, s *Schema, last bool) (Cursor, error) {
+	columns := make([]string, len(s.IdColumns))
+	order := make([]string, len(s.IdColumns))
+	for i, idColumn := range s.IdColumns {
+		columns[i] = quoteSQLite(idColumn)
+		order[i] = columns[i]
+		if last {
+			order[i] += " DESC"
+		}
+	}
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s ORDER BY %s LIMIT 1",
+		strings.Join(columns, ", "), quoteSQLite(s.Table), strings.Join(order, ", "),
+	)
+
+	cursor := make(Cursor, len(s.IdColumns))
+	values := make([]any, len(cursor))
+	for i := range cursor {
+		values[i] = &cursor[i]
+	}
+	err := db.QueryRow(query).Scan(values...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return cursor, err
+}
+
+func writeManifest(db *sql.DB, m *Manifest) error {
+	where, err := json.Marshal(m.Where)
+	if err != nil {
+		return err
+	}
+	idColumns, err := json.Marshal(m.IdColumns)
+	if err != nil {
+		return err
+	}
+	columns, err := json.Marshal(m.Columns)
+	if err != nil {
+		return err
+	}
+	version, err := json.Marshal(m.Version)
+	if err != nil {
+		return err
+	}
+	minId, err := encodeIdBound(m.MinId)
+	if err != nil {
+		return err
+	}
+	maxId, err := encodeIdBound(m.MaxId)
+	if err != nil {
+		return err
+	}
+	var finishedAt sql.NullString
+	if !m.FinishedAt.IsZero() {
+		finishedAt = sql.NullString{String: m.FinishedAt.Format(time.RFC3339), Valid: true}
+	}
+
+	_, err = db.Exec(
+		sqliteReplaceManifestQuery,
+		m.Table, m.Host, m.Database, m.Partition, string(where), string(idColumns), string(columns),
+		minId, maxId, m.RowsCopied, m.StartedAt.Format(time.RFC3339), finishedAt, string(version), m.CreateTable,
+	)
+	return err
+}
+
+func readManifest(db *sql.DB, table string) (*Manifest, error) {
+	manifests, err := readManifests(db, table)
+	if err != nil || len(manifests) == 0 {
+		return nil, err
+	}
+	return manifests[0], nil
+}
+
+// readManifests reads manifests of all tables of the archive, or of the given ones only.
+func readManifests(db *sql.DB, tables ...string) ([]*Manifest, error) {
+	query := sqliteSelectManifestsQuery
+	args := make([]any, len(tables))
+	if len(tables) > 0 {
+		query += fmt.Sprintf("\nWHERE \"table_name\" IN (%s)", strings.TrimSuffix(strings.Repeat("?, ", len(tables)), ", "))
+		for i, table := range tables {
+			args[i] = table
+		}
+	}
+	rows, err := db.Query(query+"\nORDER BY \"table_name\"", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var manifests []*Manifest
+	for rows.Next() {
+		m := &Manifest{}
+		var where, idColumns, columns, startedAt, version string
+		var minId, maxId, finishedAt sql.NullString
+		err := rows.Scan(
+			&m.Table, &m.Host, &m.Database, &m.Partition, &where, &idColumns, &columns,
+			&minId, &maxId, &m.RowsCopied, &startedAt, &finishedAt, &version, &m.CreateTable,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range []struct {
+			value string
+			into  any
+		}{{where, &m.Where}, {idColumns, &m.IdColumns}, {columns, &m.Columns}, {version, &m.Version}} {
+			if err := json.Unmarshal([]byte(field.value), field.into); err != nil {
+				return nil, fmt.Errorf("malformed manifest of table %s: %w", m.Table, err)
+			}
+		}
+		if m.MinId, err = decodeIdBound(minId); err != nil {
+			return nil, err
+		}
+		if m.MaxId, err = decodeIdBound(maxId); err != nil {
+			return nil, err
+		}
+		if m.StartedAt, err = time.Parse(time.RFC3339, startedAt); err != nil {
+			return nil, fmt.Errorf("malformed manifest of table %s: %w", m.Table, err)
+		}
+		if finishedAt.Valid {
+			if m.FinishedAt, err = time.Parse(time.RFC3339, finishedAt.String); err != nil {
+				return nil, fmt.Errorf("malformed manifest of table %s: %w", m.Table, err)
+			}
+		}
+		manifests = append(manifests, m)
+	}
+	return manifests, rows.Err()
+}
+
+func encodeIdBound(bound Cursor) (sql.NullString, error) {
+	if bound == nil {
+		return sql.NullString{}, nil
+	}
+	encoded, err := bound.Encode()
+	return sql.NullString{String: encoded, Valid: true}, err
+}
+
+func decodeIdBound(bound sql.NullString) (Cursor, error) {
+	if !bound.Valid {
+		return nil, nil
+	}
+	return DecodeCursor(bound.String)
+}
+
+// printManifest prints manifest in a human readable form.
+func printManifest(out io.Writer, m *Manifest) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Table:\t%s\n", m.Table)
+	fmt.Fprintf(w, "Source:\t%s/%s\n", m.Host, m.Database)
+	if m.Partition != "" {
+		fmt.Fprintf(w, "Partition:\t%s\n", m.Partition)
+	}
+	for _, where := range m.Where {
+		fmt.Fprintf(w, "Where:\t%s\n", where)
+	}
+	fmt.Fprintf(w, "Id columns:\t%s\n", strings.Join(m.IdColumns, ", "))
+	fmt.Fprintf(w, "Id range:\t%s - %s\n", m.MinId, m.MaxId)
+	fmt.Fprintf(w, "Rows copied:\t%d\n", m.RowsCopied)
+	fmt.Fprintf(w, "Started at:\t%s\n", m.StartedAt.Format(time.RFC3339))
+	if m.FinishedAt.IsZero() {
+		fmt.Fprintf(w, "Finished at:\tnot finished\n")
+	} else {
+		fmt.Fprintf(w, "Finished at:\t%s\n", m.FinishedAt.Format(time.RFC3339))
+	}
+	fmt.Fprintf(
+		w, "Copied by:\tarklite %s (%s-%s) built on %s with go %s\n",
+		m.Version.GitTag, m.Version.GitBranch, m.Version.GitRev, m.Version.BuildTime, m.Version.GoVersion,
+	)
+	fmt.Fprintf(w, "Columns:\n")
+	for _, column := range m.Columns {
+		fmt.Fprintf(w, "  %s\t%s\n", column.Name, column.MySQLType)
+	}
+	w.Flush()
+	if m.CreateTable != "" {
+		fmt.Fprintf(out, "MySQL definition:\n%s\n", m.CreateTable)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestManifest(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	s := &Schema{
+		Table:       "orders",
+		IdColumns:   []string{"tenant", "id"},
+		CreateTable: "CREATE TABLE `orders` (\n  `tenant` varchar(10) NOT NULL\n)",
+		Columns: []*ColumnInfo{
+			{name: "tenant", mysqlType: "VARCHAR", columnType: "varchar(10)"},
+			{name: "id", mysqlType: "BIGINT", columnType: "bigint unsigned"},
+		},
+	}
+	_, err = db.Exec(`
+CREATE TABLE orders (tenant TEXT, id INTEGER);
+INSERT INTO orders VALUES ('b', 1), ('a', 7), ('a', 3);
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := NewManifest(s, "db:3306", "shop")
+	started.StartedAt = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := startManifest(db, started); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resumed run keeps the time the copy was started at
+	resumed := NewManifest(s, "db:3306", "shop")
+	if err := startManifest(db, resumed); err != nil {
+		t.Fatal(err)
+	}
+	if !resumed.StartedAt.Equal(started.StartedAt) {
+		t.Errorf("resumed StartedAt = %s, want %s", resumed.StartedAt, started.StartedAt)
+	}
+	if err := finishManifest(db, s, resumed); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readManifest(db, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FinishedAt.IsZero() {
+		t.Error("FinishedAt is not set")
+	}
+	if want := (Cursor{"a", int64(3)}); !reflect.DeepEqual(got.MinId, want) {
+		t.Errorf("MinId = %v, want %v", got.MinId, want)
+	}
+	if want := (Cursor{"b", int64(1)}); !reflect.DeepEqual(got.MaxId, want) {
+		t.Errorf("MaxId = %v, want %v", got.MaxId, want)
+	}
+	wantColumns := []ManifestColumn{{"tenant", "varchar(10)"}, {"id", "bigint unsigned"}}
+	if !reflect.DeepEqual(got.Columns, wantColumns) {
+		t.Errorf("Columns = %v, want %v", got.Columns, wantColumns)
+	}
+	if got.CreateTable != s.CreateTable {
+		t.Errorf("CreateTable = %q, want %q", got.CreateTable, s.CreateTable)
+	}
+	if got.Host != "db:3306" || got.Database != "shop" || !reflect.DeepEqual(got.IdColumns, s.IdColumns) {
+		t.Errorf("manifest = %+v", got)
+	}
+}
+
+func TestAppendAfterUnfinishedCopy(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	s := &Schema{
+		Table:     "orders",
+		IdColumns: []string{"id"},
+		Columns:   []*ColumnInfo{{name: "id", mysqlType: "BIGINT", columnType: "bigint"}},
+	}
+	c := NewCopier(nil, db, s, CopierOptions{Append: true})
+	if err := c.CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.startCheckpoint(nil, 0); err != nil {
+		t.Fatal(err)
+	}
+	manifest := NewManifest(s, "db:3306", "shop")
+	if err := startManifest(db, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.CreateTable(); err == nil {
+		t.Error("appending after unfinished copy, want error")
+	}
+	if err := finishManifest(db, s, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateTable(); err != nil {
+		t.Errorf("appending after finished copy: %v", err)
+	}
+}
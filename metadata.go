@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// _arklite_columns describes how every column is stored, so the data can be read back faithfully.
+const sqliteCreateColumnsTableQuery = `
+CREATE TABLE IF NOT EXISTS "_arklite_columns" (
+  "table_name" TEXT NOT NULL,
+  "column_name" TEXT NOT NULL,
+  "position" INTEGER NOT NULL,
+  "mysql_type" TEXT NOT NULL,
+  "sqlite_type" TEXT NOT NULL,
+  "format" TEXT NOT NULL,
+  "precision" INTEGER NOT NULL,
+  "scale" INTEGER NOT NULL,
+  PRIMARY KEY ("table_name", "column_name")
+)`
+
+const sqliteDeleteColumnsQuery = `
+DELETE FROM "_arklite_columns" WHERE "table_name" = ?`
+
+const sqliteInsertColumnQuery = `
+INSERT INTO "_arklite_columns" (
+  "table_name", "column_name", "position", "mysql_type", "sqlite_type", "format", "precision", "scale"
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+const sqliteSelectColumnsQuery = `
+SELECT "column_name", "mysql_type", "sqlite_type", "format", "precision", "scale"
+FROM "_arklite_columns"
+WHERE "table_name" = ?
+ORDER BY "position"`
+
+func writeColumnsMetadata(db *sql.DB, s *Schema) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(sqliteCreateColumnsTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(sqliteDeleteColumnsQuery, s.Table); err != nil {
+		return err
+	}
+	for i, column := range s.Columns {
+		mysqlType := column.columnType
+		if mysqlType == "" {
+			mysqlType = column.mysqlType
+		}
+		_, err := tx.Exec(
+			sqliteInsertColumnQuery,
+			s.Table, column.name, i, mysqlType, column.sqliteType, column.format, column.precision, column.scale,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// sqliteTableExists tells if the SQLite database has the table.
+func sqliteTableExists(db *sql.DB, table string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&exists)
+	return exists, err
+}
+
+// readColumnsMetadata reads how columns of the table are stored, nil for tables without metadata.
+func readColumnsMetadata(db *sql.DB, table string) ([]*ColumnInfo, error) {
+	if exists, err := sqliteTableExists(db, "_arklite_columns"); err != nil || !exists {
+		return nil, err
+	}
+	rows, err := db.Query(sqliteSelectColumnsQuery, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []*ColumnInfo
+	for rows.Next() {
+		column := &ColumnInfo{}
+		if err := rows.Scan(&column.name, &column.columnType, &column.sqliteType, &column.format, &column.precision, &column.scale); err != nil {
+			return nil, err
+		}
+		column.mysqlType = column.columnType
+		words := strings.FieldsFunc(column.columnType, func(r rune) bool {
+			return r == '(' || r == ' '
+		})
+		if len(words) == 0 {
+			return nil, fmt.Errorf("column %s of table %s has no MySQL type in the archive", column.name, table)
+		}
+		column.dataType = strings.ToLower(words[0])
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// checkColumnsMetadata makes sure the table was archived with the same columns stored the same way as the schema has them.
+func checkColumnsMetadata(db *sql.DB, s *Schema) error {
+	archived, err := readColumnsMetadata(db, s.Table)
+	if err != nil {
+		return err
+	}
+	if archived == nil {
+		return fmt.Errorf("table %s has no column metadata, it was copied by an older arklite", s.Table)
+	}
+
+	describe := func(column *ColumnInfo) string {
+		mysqlType := column.columnType
+		if mysqlType == "" {
+			mysqlType = column.mysqlType
+		}
+		description := fmt.Sprintf("%s %s as %s", column.name, mysqlType, column.sqliteType)
+		if column.format != "" {
+			description += " " + column.format
+		}
+		return description
+	}
+	was := make([]string, len(archived))
+	for i, column := range archived {
+		was[i] = describe(column)
+	}
+	now := make([]string, len(s.Columns))
+	for i, column := range s.Columns {
+		now[i] = describe(column)
+	}
+	if !slices.Equal(was, now) {
+		return fmt.Errorf("columns do not match the archived table: was [%s], now [%s]", strings.Join(was, ", "), strings.Join(now, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestCheckColumnsMetadata(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	newSchema := func(format string) *Schema {
+		return &Schema{
+			Table: "orders",
+			Columns: []*ColumnInfo{
+				{name: "id", mysqlType: "INT", columnType: "int", sqliteType: "INTEGER"},
+				{name: "total", mysqlType: "DECIMAL", columnType: "decimal(10,2)", sqliteType: sqliteType("DECIMAL", format), format: format, scale: 2},
+			},
+		}
+	}
+
+	if err := checkColumnsMetadata(db, newSchema(DecimalText)); err == nil {
+		t.Error("checkColumnsMetadata() without metadata succeeded")
+	}
+	if err := writeColumnsMetadata(db, newSchema(DecimalText)); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkColumnsMetadata(db, newSchema(DecimalText)); err != nil {
+		t.Errorf("checkColumnsMetadata() of the same schema = %v", err)
+	}
+	if err := checkColumnsMetadata(db, newSchema(DecimalInteger)); err == nil {
+		t.Error("checkColumnsMetadata() of a column stored differently succeeded")
+	}
+	changed := newSchema(DecimalText)
+	changed.Columns = changed.Columns[:1]
+	if err := checkColumnsMetadata(db, changed); err == nil {
+		t.Error("checkColumnsMetadata() of a dropped column succeeded")
+	}
+
+	if _, err := db.Exec(`UPDATE "_arklite_columns" SET "mysql_type" = ' ' WHERE "column_name" = 'total'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readColumnsMetadata(db, "orders"); err == nil {
+		t.Error("readColumnsMetadata() of a column without MySQL type succeeded")
+	}
+}
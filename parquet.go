@@ -0,0 +1,395 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"math/big"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+// Compression codecs of Parquet files
+var parquetCodecs = map[string]compress.Codec{
+	"snappy": &parquet.Snappy,
+	"gzip":   &parquet.Gzip,
+	"zstd":   &parquet.Zstd,
+	"lz4":    &parquet.Lz4Raw,
+	"brotli": &parquet.Brotli,
+	"none":   &parquet.Uncompressed,
+}
+
+var parquetCompressions = []string{"snappy", "gzip", "zstd", "lz4", "brotli", "none"}
+
+// ParquetWriter writes rows of a table into a Parquet file. The file is written
+// next to the path and moved into place once it is complete.
+type ParquetWriter struct {
+	path    string
+	file    *os.File
+	schema  *Schema
+	writer  *parquet.Writer
+	columns []parquet.LeafColumn
+	rows    []parquet.Row
+}
+
+func NewParquetWriter(path string, s *Schema, opts FileOptions) (*ParquetWriter, error) {
+	codec, found := parquetCodecs[opts.Compression]
+	if !found {
+		return nil, fmt.Errorf("unknown compression %q, expected one of %s", opts.Compression, strings.Join(parquetCompressions, ", "))
+	}
+	schema := ParquetSchema(s)
+	w := &ParquetWriter{path: path, schema: s}
+	for _, column := range s.Columns {
+		leaf, _ := schema.Lookup(column.name)
+		w.columns = append(w.columns, leaf)
+	}
+	var err error
+	if w.file, err = os.Create(path + ".partial"); err != nil {
+		return nil, err
+	}
+	w.writer = parquet.NewWriter(
+		w.file,
+		schema,
+		parquet.MaxRowsPerRowGroup(int64(opts.BatchSize)),
+		parquet.Compression(codec),
+		parquet.CreatedBy("arklite", "", ""),
+	)
+	return w, nil
+}
+
+// ParquetSchema maps columns of MySQL table to Parquet columns. Nullable and temporal
+// columns, which may have zero dates, are optional.
+func ParquetSchema(s *Schema) *parquet.Schema {
+	group := parquetGroup{Group: parquet.Group{}}
+	for _, column := range s.Columns {
+		node := column.parquetNode()
+		if column.nullable || column.temporal() {
+			node = parquet.Optional(node)
+		}
+		group.Group[column.name] = node
+		group.names = append(group.names, column.name)
+	}
+	return parquet.NewSchema(s.Table, group)
+}
+
+// parquetGroup is parquet.Group keeping the columns in the order of MySQL table instead of sorting them by name.
+type parquetGroup struct {
+	parquet.Group
+	names []string
+}
+
+func (g parquetGroup) Fields() []parquet.Field {
+	fields := make([]parquet.Field, len(g.names))
+	for i, name := range g.names {
+		fields[i] = parquetField{Node: g.Group[name], name: name}
+	}
+	return fields
+}
+
+type parquetField struct {
+	parquet.Node
+	name string
+}
+
+func (f parquetField) Name() string {
+	return f.name
+}
+
+// Value is only used to write Go values, rows are written as they are.
+func (f parquetField) Value(base reflect.Value) reflect.Value {
+	return base.MapIndex(reflect.ValueOf(f.name))
+}
+
+func (w *ParquetWriter) WriteBatch(batch []copiedRow) error {
+	batchStartAt := time.Now()
+	w.rows = w.rows[:0]
+	for _, copied := range batch {
+		row := make(parquet.Row, len(w.columns))
+		for i, column := range w.schema.Columns {
+			value, err := scannedValue(copied.row[i])
+			if err != nil {
+				return err
+			}
+			v := parquet.NullValue()
+			if value != nil {
+				if v, err = column.parquetValue(value); err != nil {
+					return err
+				}
+			}
+			leaf := w.columns[i]
+			if v.IsNull() {
+				row[leaf.ColumnIndex] = v.Level(0, 0, leaf.ColumnIndex)
+			} else {
+				row[leaf.ColumnIndex] = v.Level(0, leaf.MaxDefinitionLevel, leaf.ColumnIndex)
+			}
+		}
+		w.rows = append(w.rows, row)
+	}
+	if _, err := w.writer.WriteRows(w.rows); err != nil {
+		return err
+	}
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+
+	count, suffix := humanize.ComputeSI(float64(len(batch)))
+	slog.Debug(
+		"Batch written to Parquet",
+		"batch_duration", time.Since(batchStartAt),
+		"batch_size", fmt.Sprintf("%d%s", int(count), suffix),
+	)
+	return nil
+}
+
+// Finish writes the footer and moves the complete file into place.
+func (w *ParquetWriter) Finish() error {
+	if err := w.writer.Close(); err != nil {
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	return os.Rename(w.path+".partial", w.path)
+}
+
+// Close removes the file unless it was finished.
+func (w *ParquetWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	w.file.Close()
+	w.file = nil
+	return os.Remove(w.path + ".partial")
+}
+
+var parquetIntBits = map[string]int{"tinyint": 8, "smallint": 16, "mediumint": 32, "int": 32, "integer": 32, "bigint": 64}
+
+func (c *ColumnInfo) parquetNode() parquet.Node {
+	switch {
+	case c.integer():
+		if c.unsigned() {
+			return parquet.Uint(parquetIntBits[c.dataType])
+		}
+		return parquet.Int(parquetIntBits[c.dataType])
+	case c.dataType == "year":
+		return parquet.Int(16)
+	case c.dataType == "decimal":
+		switch {
+		case c.precision <= 9:
+			return parquet.Decimal(c.scale, c.precision, parquet.Int32Type)
+		case c.precision <= 18:
+			return parquet.Decimal(c.scale, c.precision, parquet.Int64Type)
+		default:
+			return parquet.Decimal(c.scale, c.precision, parquet.FixedLenByteArrayType(decimalBytes(c.precision)))
+		}
+	case c.dataType == "float":
+		return parquet.Leaf(parquet.FloatType)
+	case c.dataType == "double" || c.dataType == "real":
+		return parquet.Leaf(parquet.DoubleType)
+	case c.dataType == "date":
+		return parquet.Date()
+	case c.dataType == "datetime" || c.dataType == "timestamp":
+		// DATETIME is local time of unknown zone unless it is converted from --datetime-tz
+		return parquet.TimestampAdjusted(parquet.Microsecond, c.dataType == "timestamp" || c.location != nil)
+	case c.binary():
+		return parquet.Leaf(parquet.ByteArrayType)
+	case c.dataType == "json":
+		return parquet.JSON()
+	default:
+		return parquet.String()
+	}
+}
+
+// parquetValue converts non-NULL scanned MySQL value into the value of the column's Parquet type.
+// Zero dates are NULL unless --zero-date asks otherwise.
+func (c *ColumnInfo) parquetValue(value any) (parquet.Value, error) {
+	switch {
+	case c.integer() || c.dataType == "year":
+		if c.unsigned() {
+			v, err := uintValue(value)
+			if err != nil {
+				return parquet.Value{}, fmt.Errorf("column %s: %w", c.name, err)
+			}
+			if parquetIntBits[c.dataType] == 64 {
+				return parquet.Int64Value(int64(v)), nil
+			}
+			return parquet.Int32Value(int32(uint32(v))), nil
+		}
+		v, err := intValue(value)
+		if err != nil {
+			return parquet.Value{}, fmt.Errorf("column %s: %w", c.name, err)
+		}
+		if parquetIntBits[c.dataType] == 64 {
+			return parquet.Int64Value(v), nil
+		}
+		return parquet.Int32Value(int32(v)), nil
+
+	case c.dataType == "decimal":
+		scaled, err := scaleBigDecimal(textValue(value), c.scale)
+		if err != nil {
+			return parquet.Value{}, fmt.Errorf("column %s: %w", c.name, err)
+		}
+		switch {
+		case c.precision <= 9:
+			return parquet.Int32Value(int32(scaled.Int64())), nil
+		case c.precision <= 18:
+			return parquet.Int64Value(scaled.Int64()), nil
+		default:
+			return parquet.FixedLenByteArrayValue(twosComplement(scaled, decimalBytes(c.precision))), nil
+		}
+
+	case c.dataType == "float" || c.dataType == "double" || c.dataType == "real":
+		v, err := floatValue(value)
+		if err != nil {
+			return parquet.Value{}, fmt.Errorf("column %s: %w", c.name, err)
+		}
+		if c.dataType == "float" {
+			return parquet.FloatValue(float32(v)), nil
+		}
+		return parquet.DoubleValue(v), nil
+
+	case c.temporal():
+		text := textValue(value)
+		if zeroDate(text) {
+			switch c.zeroDate {
+			case ZeroDateNull:
+				return parquet.NullValue(), nil
+			default:
+				return parquet.Value{}, fmt.Errorf("zero date %s in column %s can not be written to Parquet", text, c.name)
+			}
+		}
+		location := c.location
+		if location == nil {
+			location = time.UTC
+		}
+		layout := time.DateTime
+		if c.dataType == "date" {
+			layout = time.DateOnly
+		}
+		t, err := time.ParseInLocation(layout, text, location)
+		if err != nil {
+			return parquet.Value{}, fmt.Errorf("bad %s value in column %s: %w", strings.ToUpper(c.dataType), c.name, err)
+		}
+		if c.dataType == "date" {
+			return parquet.Int32Value(int32(t.Unix() / 86400)), nil
+		}
+		return parquet.Int64Value(t.UnixMicro()), nil
+
+	default:
+		switch v := value.(type) {
+		case []byte:
+			return parquet.ByteArrayValue(v), nil
+		default:
+			return parquet.ByteArrayValue([]byte(textValue(v))), nil
+		}
+	}
+}
+
+func (c *ColumnInfo) unsigned() bool {
+	return strings.Contains(strings.ToLower(c.columnType), "unsigned")
+}
+
+func (c *ColumnInfo) binary() bool {
+	return strings.Contains(c.dataType, "blob") || strings.Contains(c.dataType, "binary") ||
+		slices.Contains([]string{"bit", "geometry", "point", "linestring", "polygon", "multipoint", "multilinestring", "multipolygon", "geometrycollection"}, c.dataType)
+}
+
+func textValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func intValue(value any) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case int32:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	case string, []byte:
+		return strconv.ParseInt(textValue(v), 10, 64)
+	default:
+		return 0, fmt.Errorf("unexpected integer value of type %T", value)
+	}
+}
+
+func uintValue(value any) (uint64, error) {
+	switch v := value.(type) {
+	case uint64:
+		return v, nil
+	case uint32:
+		return uint64(v), nil
+	case uint16:
+		return uint64(v), nil
+	case uint8:
+		return uint64(v), nil
+	case int64:
+		return uint64(v), nil
+	case string, []byte:
+		return strconv.ParseUint(textValue(v), 10, 64)
+	default:
+		return 0, fmt.Errorf("unexpected integer value of type %T", value)
+	}
+}
+
+func floatValue(value any) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case string, []byte:
+		return strconv.ParseFloat(textValue(v), 64)
+	default:
+		return 0, fmt.Errorf("unexpected floating point value of type %T", value)
+	}
+}
+
+// scaleBigDecimal is scaleDecimal for decimals of any precision.
+func scaleBigDecimal(value string, scale int) (*big.Int, error) {
+	whole, fraction, _ := strings.Cut(value, ".")
+	if len(fraction) > scale {
+		return nil, fmt.Errorf("decimal %s has more than %d digits after the point", value, scale)
+	}
+	scaled, ok := new(big.Int).SetString(whole+fraction+strings.Repeat("0", scale-len(fraction)), 10)
+	if !ok {
+		return nil, fmt.Errorf("bad decimal %s", value)
+	}
+	return scaled, nil
+}
+
+// decimalBytes is the size of the smallest two's complement integer holding every decimal of the precision.
+func decimalBytes(precision int) int {
+	return int(math.Ceil((float64(precision)*math.Log2(10) + 1) / 8))
+}
+
+// twosComplement encodes the integer as big-endian two's complement of the given size.
+func twosComplement(v *big.Int, size int) []byte {
+	b := make([]byte, size)
+	if v.Sign() >= 0 {
+		return v.FillBytes(b)
+	}
+	// -v is 2^(8*size) - |v|
+	modulus := new(big.Int).Lsh(big.NewInt(1), uint(8*size))
+	return new(big.Int).Add(modulus, v).FillBytes(b)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestParquetWriter(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Schema{
+		Table: "orders",
+		Columns: []*ColumnInfo{
+			{name: "id", dataType: "bigint", columnType: "bigint unsigned", reflectType: reflect.TypeOf(uint64(0))},
+			{name: "total", dataType: "decimal", columnType: "decimal(30,2)", precision: 30, scale: 2, nullable: true, reflectType: reflect.TypeOf(sql.NullString{})},
+			{name: "paid", dataType: "datetime", columnType: "datetime", location: berlin, zeroDate: ZeroDateNull, reflectType: reflect.TypeOf(sql.NullString{})},
+			{name: "shipped", dataType: "date", columnType: "date", zeroDate: ZeroDateNull, reflectType: reflect.TypeOf(sql.NullString{})},
+			{name: "note", dataType: "varchar", columnType: "varchar(10)", nullable: true, reflectType: reflect.TypeOf(sql.NullString{})},
+			{name: "data", dataType: "blob", columnType: "blob", reflectType: reflect.TypeOf([]byte{})},
+		},
+	}
+	row := func(id uint64, total, paid, shipped, note sql.NullString, data []byte) copiedRow {
+		r := s.NewRow()
+		*r[0].(*uint64) = id
+		*r[1].(*sql.NullString) = total
+		*r[2].(*sql.NullString) = paid
+		*r[3].(*sql.NullString) = shipped
+		*r[4].(*sql.NullString) = note
+		*r[5].(*[]byte) = data
+		return copiedRow{row: r}
+	}
+	valid := func(v string) sql.NullString { return sql.NullString{String: v, Valid: true} }
+
+	path := filepath.Join(t.TempDir(), "orders.parquet")
+	w, err := NewParquetWriter(path, s, FileOptions{Format: FormatParquet, Compression: "zstd", BatchSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	batches := [][]copiedRow{
+		{row(18446744073709551615, valid("-12.30"), valid("2025-01-02 03:04:05.5"), valid("1969-12-31"), valid("first"), []byte{0, 1})},
+		{row(2, sql.NullString{}, valid("0000-00-00 00:00:00"), valid("2025-00-00"), sql.NullString{}, []byte{})},
+	}
+	for _, batch := range batches {
+		if err := w.WriteBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Error("file is in place before it is finished")
+	}
+	if err := w.Finish(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parquet.OpenFile(f, stat.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(file.RowGroups()); got != 2 {
+		t.Errorf("row groups = %d, want 2", got)
+	}
+
+	wantTypes := []string{"INT(64,false)", "DECIMAL(30,2)", "TIMESTAMP(isAdjustedToUTC=true,unit=MICROS)", "DATE", "STRING", "BYTE_ARRAY"}
+	for i, field := range file.Schema().Fields() {
+		if field.Name() != s.Columns[i].name {
+			t.Errorf("column %d = %s, want %s", i, field.Name(), s.Columns[i].name)
+		}
+		if got := field.Type().String(); got != wantTypes[i] {
+			t.Errorf("type of %s = %s, want %s", field.Name(), got, wantTypes[i])
+		}
+		if got, want := field.Optional(), i > 0 && i < 5; got != want {
+			t.Errorf("%s optional = %t, want %t", field.Name(), got, want)
+		}
+	}
+
+	rows := make([]parquet.Row, 3)
+	n, _ := parquet.NewReader(file).ReadRows(rows)
+	if n != 2 {
+		t.Fatalf("read %d rows, want 2", n)
+	}
+	first, second := rows[0], rows[1]
+	if got := first[0].Uint64(); got != 18446744073709551615 {
+		t.Errorf("id = %d", got)
+	}
+	if want := twosComplement(big.NewInt(-1230), decimalBytes(30)); !bytes.Equal(first[1].ByteArray(), want) {
+		t.Errorf("total = %x, want %x", first[1].ByteArray(), want)
+	}
+	if want := time.Date(2025, 1, 2, 2, 4, 5, 5e8, time.UTC).UnixMicro(); first[2].Int64() != want {
+		t.Errorf("paid = %d, want %d", first[2].Int64(), want)
+	}
+	if first[3].Int32() != -1 {
+		t.Errorf("shipped = %d, want -1", first[3].Int32())
+	}
+	if string(first[4].ByteArray()) != "first" || !bytes.Equal(first[5].ByteArray(), []byte{0, 1}) {
+		t.Errorf("note, data = %q, %x", first[4].ByteArray(), first[5].ByteArray())
+	}
+	for i := 1; i < 5; i++ {
+		if !second[i].IsNull() {
+			t.Errorf("%s = %v, want NULL", s.Columns[i].name, second[i])
+		}
+	}
+}
+
+func TestParquetWriterCleansUp(t *testing.T) {
+	s := &Schema{
+		Table:   "orders",
+		Columns: []*ColumnInfo{{name: "d", dataType: "date", columnType: "date", zeroDate: ZeroDateKeep, reflectType: reflect.TypeOf(sql.NullString{})}},
+	}
+	dir := t.TempDir()
+	w, err := NewParquetWriter(filepath.Join(dir, "orders.parquet"), s, FileOptions{Format: FormatParquet, Compression: "snappy", BatchSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := s.NewRow()
+	*row[0].(*sql.NullString) = sql.NullString{String: "0000-00-00", Valid: true}
+	if err := w.WriteBatch([]copiedRow{{row: row}}); err == nil {
+		t.Error("zero date kept as it is, want error")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("left %d files behind", len(entries))
+	}
+}
+
+func TestTwosComplement(t *testing.T) {
+	tests := []struct {
+		value int64
+		size  int
+		want  []byte
+	}{
+		{0, 2, []byte{0, 0}},
+		{1230, 2, []byte{0x04, 0xce}},
+		{-1, 3, []byte{0xff, 0xff, 0xff}},
+		{-1230, 2, []byte{0xfb, 0x32}},
+	}
+	for _, tt := range tests {
+		if got := twosComplement(big.NewInt(tt.value), tt.size); !bytes.Equal(got, tt.want) {
+			t.Errorf("twosComplement(%d, %d) = %x, want %x", tt.value, tt.size, got, tt.want)
+		}
+	}
+	for precision, want := range map[int]int{19: 9, 30: 13, 38: 16, 65: 28} {
+		if got := decimalBytes(precision); got != want {
+			t.Errorf("decimalBytes(%d) = %d, want %d", precision, got, want)
+		}
+	}
+}
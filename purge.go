@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// _arklite_purge keeps ids of rows committed to SQLite until they are purged from MySQL, so that
+// rows of a batch interrupted between its commit and its purge are purged on resume.
+const sqliteCreatePurgeTableQuery = `
+CREATE TABLE IF NOT EXISTS "_arklite_purge" (
+  "table_name" TEXT NOT NULL,
+  "id" TEXT NOT NULL,
+  PRIMARY KEY ("table_name", "id")
+)`
+
+const sqliteInsertPurgeQuery = `
+INSERT OR IGNORE INTO "_arklite_purge" ("table_name", "id") VALUES (?, ?)`
+
+const sqliteSelectPurgeQuery = `
+SELECT "id" FROM "_arklite_purge" WHERE "table_name" = ? ORDER BY rowid`
+
+const sqliteDeletePurgeQuery = `
+DELETE FROM "_arklite_purge" WHERE "table_name" = ? AND "id" = ?`
+
+// readPendingPurge reads ids of rows committed to SQLite but not purged from MySQL yet.
+func readPendingPurge(db *sql.DB, table string) ([]Cursor, error) {
+	if exists, err := sqliteTableExists(db, "_arklite_purge"); err != nil || !exists {
+		return nil, err
+	}
+	rows, err := db.Query(sqliteSelectPurgeQuery, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []Cursor
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, err
+		}
+		key, err := DecodeCursor(encoded)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// purgePending purges rows an interrupted run committed to SQLite but did not purge from MySQL.
+// Without --purge they are left for a later run with it.
+func (c *Copier) purgePending() error {
+	keys, err := readPendingPurge(c.sqliteDb, c.schema.Table)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	if !c.opts.Purge {
+		slog.Warn("Rows copied by a previous run are not purged from MySQL yet, run with --purge to delete them", "table", c.schema.Table, "rows", len(keys))
+		return nil
+	}
+	slog.Info("Purging rows left by a previous run", "table", c.schema.Table, "rows", len(keys))
+	return c.purge(c.sqliteDb, keys)
+}
+
+// forgetPurged removes purged rows from _arklite_purge.
+func forgetPurged(db *sql.DB, table string, keys []Cursor) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(sqliteDeletePurgeQuery)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, key := range keys {
+		encoded, err := key.Encode()
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.Exec(table, encoded); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// purge deletes rows with given keys from MySQL in chunks. Every chunk is
+// checked against SQLite first and nothing is deleted unless all of its rows
+// are present in the SQLite file they were written to.
+func (c *Copier) purge(sqliteDb *sql.DB, keys []Cursor) error {
+	for chunk := range slices.Chunk(keys, c.opts.PurgeChunkSize) {
+		// Rows already written are purged even when the copy has stopped
+		if err := c.opts.Throttler.Wait(func() bool { return false }); err != nil {
+			return err
+		}
+		chunkStartAt := time.Now()
+
+		args := make([]any, 0, len(chunk)*len(c.schema.IdColumns))
+		sqliteArgs := make([]any, 0, len(chunk)*len(c.schema.IdColumns))
+		for _, key := range chunk {
+			args = append(args, key...)
+			sqliteKey, err := c.schema.SqliteKey(key)
+			if err != nil {
+				return err
+			}
+			sqliteArgs = append(sqliteArgs, sqliteKey...)
+		}
+
+		confirmed, err := countInSqlite(sqliteDb, c.schema, len(chunk), sqliteArgs)
+		if err != nil {
+			return err
+		}
+		if confirmed != len(chunk) {
+			return fmt.Errorf(
+				"only %d of %d rows with ids %s..%s found in SQLite, refusing to delete them from MySQL",
+				confirmed, len(chunk), chunk[0], chunk[len(chunk)-1],
+			)
+		}
+
+		res, err := c.mysqlDb.Exec(c.schema.MySQLDeleteQuery(len(chunk)), args...)
+		if err != nil {
+			return err
+		}
+		deleted, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		c.rowsPurged += uint64(deleted)
+		if err := forgetPurged(sqliteDb, c.schema.Table, chunk); err != nil {
+			return err
+		}
+
+		slog.Debug(
+			"Chunk purged from MySQL",
+			"chunk_duration", time.Since(chunkStartAt),
+			"first_id", chunk[0],
+			"last_id", chunk[len(chunk)-1],
+			"rows_deleted", deleted,
+		)
+
+		if c.opts.PurgeSleep > 0 {
+			time.Sleep(c.opts.PurgeSleep)
+		}
+	}
+	return nil
+}
+
+func countInSqlite(db *sql.DB, s *Schema, count int, args []any) (int, error) {
+	var found int
+	err := db.QueryRow(s.SQLiteCountIdsQuery(count), args...).Scan(&found)
+	return found, err
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestPendingPurge(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// Archives made without purging
+	if keys, err := readPendingPurge(db, "orders"); err != nil || keys != nil {
+		t.Fatalf("readPendingPurge() = %v, %v, want no keys", keys, err)
+	}
+
+	s := &Schema{
+		Table:     "orders",
+		IdColumns: []string{"id"},
+		Columns: []*ColumnInfo{
+			{name: "id", mysqlType: "INT", dataType: "int", sqliteType: "INTEGER"},
+		},
+	}
+	if _, err := db.Exec(s.SQLiteCreateTableQuery()); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeCheckpoint(db, NewCheckpoint(s)); err != nil {
+		t.Fatal(err)
+	}
+	target, err := newSQLiteTarget(db, s, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer target.Close()
+
+	keys := []Cursor{{int64(3)}, {int64(1)}, {int64(2)}}
+	for _, key := range keys {
+		encoded, err := key.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := target.purgeStmt.Exec(s.Table, encoded); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pending, err := readPendingPurge(db, "payments"); err != nil || pending != nil {
+		t.Fatalf("readPendingPurge() of another table = %v, %v, want no keys", pending, err)
+	}
+
+	if err := forgetPurged(db, s.Table, keys[:2]); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := readPendingPurge(db, s.Table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pending, keys[2:]) {
+		t.Errorf("readPendingPurge() = %v, want %v", pending, keys[2:])
+	}
+}
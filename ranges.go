@@ -0,0 +1,291 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"strings"
+)
+
+const sqliteCreateRangesTableQuery = `
+CREATE TABLE IF NOT EXISTS "_arklite_checkpoint_ranges" (
+  "table_name" TEXT NOT NULL,
+  "range_no" INTEGER NOT NULL,
+  "partitions" TEXT NOT NULL,
+  "lower" TEXT,
+  "upper" TEXT,
+  "cursor" TEXT,
+  "rows_copied" INTEGER NOT NULL,
+  PRIMARY KEY ("table_name", "range_no")
+)`
+
+const sqliteSelectRangesQuery = `
+SELECT "partitions", "lower", "upper", "cursor", "rows_copied"
+FROM "_arklite_checkpoint_ranges"
+WHERE "table_name" = ?
+ORDER BY "range_no"`
+
+const sqliteDeleteRangesQuery = `
+DELETE FROM "_arklite_checkpoint_ranges" WHERE "table_name" = ?`
+
+const sqliteInsertRangeQuery = `
+INSERT INTO "_arklite_checkpoint_ranges" (
+  "table_name", "range_no", "partitions", "lower", "upper", "cursor", "rows_copied"
+) VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+const sqliteUpdateRangeQuery = `
+UPDATE "_arklite_checkpoint_ranges"
+SET "cursor" = ?, "rows_copied" = "rows_copied" + ?
+WHERE "table_name" = ? AND "range_no" = ?`
+
+// ReadRange is a part of a table read by one of parallel readers. It is
+// either a range [Lower, Upper) of the leading id column, where nil bound
+// means no bound, or a set of MySQL partitions.
+type ReadRange struct {
+	Partitions []string
+	Lower      any
+	Upper      any
+	Cursor     Cursor
+	RowsCopied uint64
+}
+
+func (r *ReadRange) String() string {
+	if len(r.Partitions) > 0 {
+		return fmt.Sprintf("partitions %s", strings.Join(r.Partitions, ", "))
+	}
+	lower, upper := "...", "..."
+	if r.Lower != nil {
+		lower = fmt.Sprint(r.Lower)
+	}
+	if r.Upper != nil {
+		upper = fmt.Sprint(r.Upper)
+	}
+	return fmt.Sprintf("[%s, %s)", lower, upper)
+}
+
+// Args returns values of range bounds in order of placeholders of Schema.MySQLSelectRangeQuery.
+func (r *ReadRange) Args() []any {
+	var args []any
+	if r.Lower != nil {
+		args = append(args, r.Lower)
+	}
+	if r.Upper != nil {
+		args = append(args, r.Upper)
+	}
+	return args
+}
+
+// planRanges splits a table into up to n ranges by MIN/MAX of the leading
+// id column when it is an integer, or by MySQL partitions otherwise.
+// Tables which can not be split are read as a single range.
+func planRanges(db *sql.DB, s *Schema, n int) ([]*ReadRange, error) {
+	leading := s.Columns[s.ColumnIndex(s.IdColumns[0])]
+	if leading.integer() {
+		return planIdRanges(db, s, n)
+	}
+
+	var partitions []string
+	if s.Partition == "" {
+		var err error
+		partitions, err = fetchPartitions(db, s.Table)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(partitions) == 0 {
+		slog.Warn(
+			"Leading id column is not an integer and there are no partitions to split by, reading with a single reader",
+			"table", s.Table, "id-column", leading.name,
+		)
+		return []*ReadRange{{}}, nil
+	}
+	return splitPartitions(partitions, n), nil
+}
+
+func planIdRanges(db *sql.DB, s *Schema, n int) ([]*ReadRange, error) {
+	var minId, maxId sql.NullString
+	if err := db.QueryRow(s.MySQLMinMaxQuery()).Scan(&minId, &maxId); err != nil {
+		return nil, err
+	}
+	if !minId.Valid || !maxId.Valid {
+		slog.Info("Table is empty, nothing to split", "table", s.Table)
+		return []*ReadRange{{}}, nil
+	}
+
+	lower, ok := new(big.Int).SetString(minId.String, 10)
+	if !ok {
+		return nil, fmt.Errorf("unexpected minimal id %q", minId.String)
+	}
+	upper, ok := new(big.Int).SetString(maxId.String, 10)
+	if !ok {
+		return nil, fmt.Errorf("unexpected maximal id %q", maxId.String)
+	}
+	return splitIdRange(lower, upper, n), nil
+}
+
+// splitIdRange splits [lower, upper] into up to n ranges of equal width.
+// The first and the last ranges are unbounded, so no rows are missed if
+// MIN/MAX change before reading is done.
+func splitIdRange(lower, upper *big.Int, n int) []*ReadRange {
+	width := new(big.Int).Sub(upper, lower)
+	width.Add(width, big.NewInt(1))
+	if width.Cmp(big.NewInt(int64(n))) < 0 {
+		n = int(width.Int64())
+	}
+	step := new(big.Int).Div(width, big.NewInt(int64(n)))
+
+	ranges := make([]*ReadRange, n)
+	var previous any
+	for i := range ranges {
+		ranges[i] = &ReadRange{Lower: previous}
+		if i == n-1 {
+			break
+		}
+		bound := new(big.Int).Mul(step, big.NewInt(int64(i+1)))
+		bound.Add(bound, lower)
+		ranges[i].Upper = bigIdValue(bound)
+		previous = ranges[i].Upper
+	}
+	return ranges
+}
+
+func bigIdValue(v *big.Int) any {
+	if v.IsInt64() {
+		return v.Int64()
+	}
+	return v.Uint64()
+}
+
+// splitPartitions distributes partitions between up to n ranges round-robin.
+func splitPartitions(partitions []string, n int) []*ReadRange {
+	n = min(n, len(partitions))
+	ranges := make([]*ReadRange, n)
+	for i := range ranges {
+		ranges[i] = &ReadRange{}
+	}
+	for i, partition := range partitions {
+		ranges[i%n].Partitions = append(ranges[i%n].Partitions, partition)
+	}
+	return ranges
+}
+
+func fetchPartitions(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query(`
+SELECT PARTITION_NAME
+FROM information_schema.PARTITIONS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL
+ORDER BY PARTITION_ORDINAL_POSITION`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var partitions []string
+	for rows.Next() {
+		var partition string
+		if err := rows.Scan(&partition); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, partition)
+	}
+	return partitions, rows.Err()
+}
+
+func readRanges(db *sql.DB, table string) ([]*ReadRange, error) {
+	if _, err := db.Exec(sqliteCreateRangesTableQuery); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(sqliteSelectRangesQuery, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ranges []*ReadRange
+	for rows.Next() {
+		r := &ReadRange{}
+		var partitions string
+		var lower, upper, cursor sql.NullString
+		if err := rows.Scan(&partitions, &lower, &upper, &cursor, &r.RowsCopied); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(partitions), &r.Partitions); err != nil {
+			return nil, fmt.Errorf("malformed checkpoint range partitions: %w", err)
+		}
+		if r.Lower, err = decodeBound(lower); err != nil {
+			return nil, err
+		}
+		if r.Upper, err = decodeBound(upper); err != nil {
+			return nil, err
+		}
+		if cursor.Valid {
+			if r.Cursor, err = DecodeCursor(cursor.String); err != nil {
+				return nil, err
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, rows.Err()
+}
+
+func writeRanges(tx *sql.Tx, table string, ranges []*ReadRange) error {
+	if _, err := tx.Exec(sqliteCreateRangesTableQuery); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(sqliteDeleteRangesQuery, table); err != nil {
+		return err
+	}
+	for i, r := range ranges {
+		partitions, err := json.Marshal(r.Partitions)
+		if err != nil {
+			return err
+		}
+		lower, err := encodeBound(r.Lower)
+		if err != nil {
+			return err
+		}
+		upper, err := encodeBound(r.Upper)
+		if err != nil {
+			return err
+		}
+		var cursor sql.NullString
+		if r.Cursor != nil {
+			cursor.String, err = r.Cursor.Encode()
+			if err != nil {
+				return err
+			}
+			cursor.Valid = true
+		}
+		_, err = tx.Exec(sqliteInsertRangeQuery, table, i, string(partitions), lower, upper, cursor, r.RowsCopied)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Bounds are stored as single value cursors to keep their types.
+func encodeBound(bound any) (sql.NullString, error) {
+	if bound == nil {
+		return sql.NullString{}, nil
+	}
+	encoded, err := Cursor{bound}.Encode()
+	return sql.NullString{String: encoded, Valid: true}, err
+}
+
+func decodeBound(bound sql.NullString) (any, error) {
+	if !bound.Valid {
+		return nil, nil
+	}
+	cursor, err := DecodeCursor(bound.String)
+	if err != nil {
+		return nil, err
+	}
+	if len(cursor) != 1 {
+		return nil, fmt.Errorf("malformed checkpoint range bound %q", bound.String)
+	}
+	return cursor[0], nil
+}
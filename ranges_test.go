@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestSplitIdRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		lower *big.Int
+		upper *big.Int
+		n     int
+		want  []*ReadRange
+	}{
+		{"single", big.NewInt(1), big.NewInt(100), 1, []*ReadRange{{}}},
+		{
+			"even", big.NewInt(1), big.NewInt(100), 4,
+			[]*ReadRange{
+				{Upper: int64(26)},
+				{Lower: int64(26), Upper: int64(51)},
+				{Lower: int64(51), Upper: int64(76)},
+				{Lower: int64(76)},
+			},
+		},
+		{
+			"fewer ids than readers", big.NewInt(10), big.NewInt(11), 4,
+			[]*ReadRange{{Upper: int64(11)}, {Lower: int64(11)}},
+		},
+		{
+			"above int64", big.NewInt(0), new(big.Int).SetUint64(math.MaxUint64), 2,
+			[]*ReadRange{{Upper: uint64(1 << 63)}, {Lower: uint64(1 << 63)}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitIdRange(tt.lower, tt.upper, tt.n)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitIdRange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitPartitions(t *testing.T) {
+	got := splitPartitions([]string{"p0", "p1", "p2", "p3", "p4"}, 2)
+	want := []*ReadRange{{Partitions: []string{"p0", "p2", "p4"}}, {Partitions: []string{"p1", "p3"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitPartitions() = %v, want %v", got, want)
+	}
+
+	got = splitPartitions([]string{"p0"}, 4)
+	want = []*ReadRange{{Partitions: []string{"p0"}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitPartitions() = %v, want %v", got, want)
+	}
+}
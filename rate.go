@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// RateLimit caps how fast rows are read from MySQL, 0 disables either of the limits.
+type RateLimit struct {
+	RowsPerSec  int64
+	BytesPerSec int64
+}
+
+func (l RateLimit) Enabled() bool {
+	return l.RowsPerSec > 0 || l.BytesPerSec > 0
+}
+
+// probeBatchSize is the size of the first batch read under a bytes limit,
+// before there is any idea how large the rows are.
+const probeBatchSize = 100
+
+// rateLimiter is a token bucket shared by the readers of a table. Readers are charged
+// for the rows and bytes of a batch once it is read and sleep until the bucket is out of debt.
+// The bucket starts empty and holds at most a second worth of tokens, and batches are kept small
+// enough to fit into a reader's share of it, so the rate stays within the limits over any second or so.
+type rateLimiter struct {
+	limit   RateLimit
+	readers int
+
+	mu         sync.Mutex
+	rows       float64
+	bytes      float64
+	refilledAt time.Time
+	startedAt  time.Time
+	rowsRead   int64
+	bytesRead  int64
+}
+
+// newRateLimiter returns nil when neither of the limits is set, nil rateLimiter never waits.
+func newRateLimiter(limit RateLimit, readers int) *rateLimiter {
+	if !limit.Enabled() {
+		return nil
+	}
+	now := time.Now()
+	return &rateLimiter{
+		limit:      limit,
+		readers:    max(readers, 1),
+		refilledAt: now,
+		startedAt:  now,
+	}
+}
+
+// BatchSize caps the read batch size to what a reader may read in a second. For the bytes limit
+// it is estimated from the average size of rows read so far.
+func (l *rateLimiter) BatchSize(size int) int {
+	if l == nil {
+		return size
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit.RowsPerSec > 0 {
+		size = min(size, int(max(l.limit.RowsPerSec/int64(l.readers), 1)))
+	}
+	if l.limit.BytesPerSec > 0 {
+		if l.rowsRead == 0 {
+			return min(size, probeBatchSize)
+		}
+		rowSize := max(l.bytesRead/l.rowsRead, 1)
+		size = min(size, int(max(l.limit.BytesPerSec/int64(l.readers)/rowSize, 1)))
+	}
+	return size
+}
+
+// Take charges the bucket for a batch read and sleeps until it has paid off the debt.
+func (l *rateLimiter) Take(rows, bytes int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	elapsed := now.Sub(l.refilledAt).Seconds()
+	l.refilledAt = now
+	l.rowsRead += rows
+	l.bytesRead += bytes
+
+	var wait time.Duration
+	if l.limit.RowsPerSec > 0 {
+		perSec := float64(l.limit.RowsPerSec)
+		l.rows = min(l.rows+elapsed*perSec, perSec) - float64(rows)
+		wait = max(wait, debtDuration(l.rows, perSec))
+	}
+	if l.limit.BytesPerSec > 0 {
+		perSec := float64(l.limit.BytesPerSec)
+		l.bytes = min(l.bytes+elapsed*perSec, perSec) - float64(bytes)
+		wait = max(wait, debtDuration(l.bytes, perSec))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+// debtDuration is how long it takes to refill negative tokens back to zero.
+func debtDuration(tokens float64, perSec float64) time.Duration {
+	if tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tokens / perSec * float64(time.Second))
+}
+
+// String tells the effective rate since the copy started, e.g. "1.2k rows/s, 3.4 MB/s".
+func (l *rateLimiter) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elapsed := time.Since(l.startedAt).Seconds()
+	if elapsed <= 0 {
+		return "0 rows/s, 0 B/s"
+	}
+	rows, suffix := humanize.ComputeSI(float64(l.rowsRead) / elapsed)
+	return fmt.Sprintf("%.1f%s rows/s, %s/s", rows, suffix, humanize.Bytes(uint64(float64(l.bytesRead)/elapsed)))
+}
+
+// rowSize estimates how many bytes a row read from MySQL takes: the length
+// of strings and binary values and 8 bytes for anything else that is not NULL.
+func rowSize(row RowData) int64 {
+	var size int64
+	for _, scanned := range row {
+		value, err := scannedValue(scanned)
+		if err != nil {
+			continue
+		}
+		switch v := value.(type) {
+		case nil:
+		case string:
+			size += int64(len(v))
+		case []byte:
+			size += int64(len(v))
+		default:
+			size += 8
+		}
+	}
+	return size
+}
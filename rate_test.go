@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBatchSize(t *testing.T) {
+	var limiter *rateLimiter
+	if got := limiter.BatchSize(1000); got != 1000 {
+		t.Errorf("nil limiter batch size = %d, want 1000", got)
+	}
+	if newRateLimiter(RateLimit{}, 1) != nil {
+		t.Error("limiter without limits is not nil")
+	}
+
+	tests := []struct {
+		name      string
+		limit     RateLimit
+		readers   int
+		rowsRead  int64
+		bytesRead int64
+		size      int
+		want      int
+	}{
+		{"below rows limit", RateLimit{RowsPerSec: 5000}, 1, 0, 0, 1000, 1000},
+		{"rows limit", RateLimit{RowsPerSec: 500}, 1, 0, 0, 1000, 500},
+		{"rows limit shared", RateLimit{RowsPerSec: 500}, 4, 0, 0, 1000, 125},
+		{"bytes probe", RateLimit{BytesPerSec: 1 << 20}, 1, 0, 0, 100000, probeBatchSize},
+		{"bytes by row size", RateLimit{BytesPerSec: 10000}, 2, 10, 1000, 100000, 50},
+		{"huge rows", RateLimit{BytesPerSec: 10}, 1, 1, 1000, 100000, 1},
+		{"both limits", RateLimit{RowsPerSec: 30, BytesPerSec: 10000}, 1, 10, 1000, 100000, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newRateLimiter(tt.limit, tt.readers)
+			limiter.rowsRead, limiter.bytesRead = tt.rowsRead, tt.bytesRead
+			if got := limiter.BatchSize(tt.size); got != tt.want {
+				t.Errorf("BatchSize(%d) = %d, want %d", tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterTake(t *testing.T) {
+	limiter := newRateLimiter(RateLimit{RowsPerSec: 1000, BytesPerSec: 1000}, 1)
+	startedAt := time.Now()
+	limiter.Take(50, 100)
+	limiter.Take(50, 0)
+	// 100 bytes take 100ms, the rows are paid off meanwhile
+	if elapsed := time.Since(startedAt); elapsed < 90*time.Millisecond || elapsed > time.Second {
+		t.Errorf("took %s, want about 100ms", elapsed)
+	}
+	if limiter.rowsRead != 100 || limiter.bytesRead != 100 {
+		t.Errorf("read %d rows, %d bytes", limiter.rowsRead, limiter.bytesRead)
+	}
+}
+
+func TestRowSize(t *testing.T) {
+	s := &Schema{Columns: []*ColumnInfo{
+		{name: "id", reflectType: reflect.TypeOf(int64(0))},
+		{name: "note", reflectType: reflect.TypeOf(sql.NullString{})},
+		{name: "data", reflectType: reflect.TypeOf([]byte{})},
+		{name: "missing", reflectType: reflect.TypeOf(sql.NullString{})},
+	}}
+	row := s.NewRow()
+	*row[0].(*int64) = 1
+	*row[1].(*sql.NullString) = sql.NullString{String: "hello", Valid: true}
+	*row[2].(*[]byte) = []byte{1, 2, 3}
+	if got := rowSize(row); got != 16 {
+		t.Errorf("rowSize = %d, want 16", got)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/stephenafamo/bob"
+	"github.com/stephenafamo/bob/dialect/mysql"
+	"github.com/stephenafamo/bob/dialect/mysql/im"
+	"github.com/stephenafamo/bob/dialect/sqlite"
+	ssm "github.com/stephenafamo/bob/dialect/sqlite/sm"
+)
+
+// What to do with restored rows which conflict with rows already in MySQL
+const (
+	OnConflictFail    = "fail"
+	OnConflictIgnore  = "ignore"
+	OnConflictReplace = "replace"
+)
+
+var onConflictModes = []string{OnConflictFail, OnConflictIgnore, OnConflictReplace}
+
+type RestorerOptions struct {
+	// Target is the MySQL table to restore into, the archived table name when empty
+	Target     string
+	BatchSize  int
+	Limit      uint64
+	OnConflict string
+	// Where clauses are evaluated by SQLite
+	Where []string
+	// DatetimeZone is the time zone DATETIME values were converted from with --datetime-tz
+	DatetimeZone *time.Location
+	Progress     ProgressRenderer
+}
+
+// Restorer loads a table of SQLite archive back into MySQL.
+type Restorer struct {
+	mysqlDb  *sql.DB
+	sqliteDb *sql.DB
+	table    string
+	opts     RestorerOptions
+	columns  []*ColumnInfo
+
+	rowsRestored uint64
+}
+
+func NewRestorer(mysqlDb *sql.DB, sqliteDb *sql.DB, table string, opts RestorerOptions) *Restorer {
+	if opts.Target == "" {
+		opts.Target = table
+	}
+	return &Restorer{
+		mysqlDb:  mysqlDb,
+		sqliteDb: sqliteDb,
+		table:    table,
+		opts:     opts,
+	}
+}
+
+func (r *Restorer) RowsRestored() uint64 {
+	return r.rowsRestored
+}
+
+// Prepare reads how the archived columns are stored and makes sure the
+// MySQL table exists, creating it from the archived definition if it does not.
+func (r *Restorer) Prepare() error {
+	var err error
+	r.columns, err = readArchivedColumns(r.sqliteDb, r.table)
+	if err != nil {
+		return err
+	}
+	for _, column := range r.columns {
+		if column.temporal() && column.dataType == "datetime" {
+			column.location = r.opts.DatetimeZone
+		}
+	}
+
+	targetColumns, err := fetchTargetColumns(r.mysqlDb, r.opts.Target)
+	if err != nil {
+		return err
+	}
+	if targetColumns == nil {
+		if err := r.createTable(); err != nil {
+			return err
+		}
+		if targetColumns, err = fetchTargetColumns(r.mysqlDb, r.opts.Target); err != nil {
+			return err
+		}
+	}
+
+	// Generated columns were archived as plain ones, MySQL computes them again
+	r.columns = slices.DeleteFunc(r.columns, func(column *ColumnInfo) bool {
+		generated, found := targetColumns[column.name]
+		if found && generated {
+			slog.Info("Skipping generated column", "table", r.opts.Target, "column", column.name)
+		}
+		return found && generated
+	})
+	for _, column := range r.columns {
+		if _, found := targetColumns[column.name]; !found {
+			return fmt.Errorf("column %s is not found in MySQL table %s", column.name, r.opts.Target)
+		}
+	}
+	return nil
+}
+
+func (r *Restorer) createTable() error {
+	manifest, err := readManifest(r.sqliteDb, r.table)
+	if err != nil {
+		return fmt.Errorf("MySQL table %s does not exist and archive has no definition for it: %w", r.opts.Target, err)
+	}
+	if manifest == nil || manifest.CreateTable == "" {
+		return fmt.Errorf("MySQL table %s does not exist and archive has no definition for it", r.opts.Target)
+	}
+
+	slog.Info("Creating MySQL table from the archived definition", "table", r.opts.Target)
+	query := renameCreateTable(manifest.CreateTable, r.opts.Target)
+	slog.Debug(query)
+	_, err = r.mysqlDb.Exec(query)
+	return err
+}
+
+var createTableName = regexp.MustCompile("^(?i)(CREATE TABLE )`(?:[^`]|``)+`")
+
+// renameCreateTable changes table name in SHOW CREATE TABLE output.
+func renameCreateTable(createTable string, table string) string {
+	return createTableName.ReplaceAllLiteralString(createTable, "CREATE TABLE "+quoteMySQL(table))
+}
+
+// Restore reads rows from SQLite and inserts them into MySQL in batches.
+func (r *Restorer) Restore() error {
+	slog.Info("Restoring data from SQLite to MySQL", "table", r.table, "target", r.opts.Target)
+
+	rows, err := r.sqliteDb.Query(r.SQLiteSelectQuery())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	batchSize := r.statementRows()
+	stmt, err := r.mysqlDb.Prepare(r.MySQLInsertQuery(batchSize))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	r.opts.Progress.RenderBlank()
+	defer r.opts.Progress.Finish()
+
+	batch := make([]any, 0, batchSize*len(r.columns))
+	batchRows := 0
+	insertBatch := func() error {
+		if batchRows == 0 {
+			return nil
+		}
+		batchStartAt := time.Now()
+		var err error
+		if batchRows == batchSize {
+			_, err = stmt.Exec(batch...)
+		} else {
+			_, err = r.mysqlDb.Exec(r.MySQLInsertQuery(batchRows), batch...)
+		}
+		if err != nil {
+			return err
+		}
+		r.rowsRestored += uint64(batchRows)
+		if err := r.opts.Progress.Add64(int64(batchRows)); err != nil {
+			return err
+		}
+		slog.Debug("Batch restored to MySQL", "batch_duration", time.Since(batchStartAt), "batch_size", batchRows)
+		batch = batch[:0]
+		batchRows = 0
+		return nil
+	}
+
+	values := make([]any, len(r.columns))
+	scanned := make([]any, len(r.columns))
+	for i := range values {
+		scanned[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(scanned...); err != nil {
+			return err
+		}
+		for i, column := range r.columns {
+			value, err := column.mysqlValue(values[i])
+			if err != nil {
+				return err
+			}
+			batch = append(batch, value)
+		}
+		batchRows++
+		if batchRows == batchSize {
+			if err := insertBatch(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return insertBatch()
+}
+
+// maxPlaceholders is the limit of placeholders in a single prepared statement of MySQL.
+const maxPlaceholders = 65535
+
+// statementRows is the number of rows inserted with a single statement, --write-batch
+// capped so that wide tables do not go over the placeholders limit of MySQL.
+func (r *Restorer) statementRows() int {
+	return max(min(r.opts.BatchSize, maxPlaceholders/max(len(r.columns), 1)), 1)
+}
+
+// SQLiteSelectQuery selects archived rows to restore.
+func (r *Restorer) SQLiteSelectQuery() string {
+	columns := make([]any, len(r.columns))
+	for i, column := range r.columns {
+		columns[i] = sqlite.Quote(column.name)
+	}
+	q := sqlite.Select(
+		ssm.Columns(columns...),
+		ssm.From(sqlite.Quote(r.table)),
+	)
+	for _, where := range r.opts.Where {
+		q.Apply(ssm.Where(sqlite.Raw(where)))
+	}
+	if r.opts.Limit > 0 {
+		q.Apply(ssm.Limit(r.opts.Limit))
+	}
+
+	sql, _, err := q.Build(context.Background())
+	if err != nil {
+		return ""
+	}
+	return sql
+}
+
+// MySQLInsertQuery inserts count rows with a single statement.
+func (r *Restorer) MySQLInsertQuery(count int) string {
+	names := make([]string, len(r.columns))
+	for i, column := range r.columns {
+		names[i] = column.name
+	}
+	rows := make([][]bob.Expression, count)
+	for i := range rows {
+		rows[i] = []bob.Expression{mysql.Placeholder(uint(len(names)))}
+	}
+	q := mysql.Insert(
+		im.Into(mysql.Quote(r.opts.Target), names...),
+		im.Rows(rows...),
+	)
+	switch r.opts.OnConflict {
+	case OnConflictIgnore:
+		q.Apply(im.Ignore())
+	case OnConflictReplace:
+		q.Apply(im.OnDuplicateKeyUpdate(im.UpdateWithValues(names...)))
+	}
+
+	sql, _, err := q.Build(context.Background())
+	if err != nil {
+		return ""
+	}
+	return sql
+}
+
+// readArchivedColumns reads how columns of archived table are stored. Archives
+// made before the column metadata was recorded store all values as they are.
+func readArchivedColumns(db *sql.DB, table string) ([]*ColumnInfo, error) {
+	columns, err := readColumnsMetadata(db, table)
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) > 0 {
+		return columns, nil
+	}
+
+	slog.Warn("No column metadata in the archive, restoring values as they are stored", "table", table)
+	pragma, err := db.Query("SELECT name FROM pragma_table_info(?) ORDER BY cid", table)
+	if err != nil {
+		return nil, err
+	}
+	defer pragma.Close()
+	for pragma.Next() {
+		column := &ColumnInfo{}
+		if err := pragma.Scan(&column.name); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	if err := pragma.Err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s is not found in the archive", table)
+	}
+	return columns, nil
+}
+
+// fetchTargetColumns returns columns of MySQL table, telling which of them
+// are generated. Nil means there is no such table.
+func fetchTargetColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query(`
+SELECT COLUMN_NAME, EXTRA, COALESCE(GENERATION_EXPRESSION, '')
+FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns map[string]bool
+	for rows.Next() {
+		var name, extra, generation string
+		if err := rows.Scan(&name, &extra, &generation); err != nil {
+			return nil, err
+		}
+		if columns == nil {
+			columns = map[string]bool{}
+		}
+		extra = strings.ToUpper(extra)
+		columns[name] = generation != "" || strings.Contains(extra, "VIRTUAL GENERATED") || strings.Contains(extra, "STORED GENERATED")
+	}
+	return columns, rows.Err()
+}
+
+// archivedTables lists data tables of SQLite archive matching the given names or glob patterns.
+// Tables of arklite and internal tables of SQLite, like sqlite_sequence or sqlite_stat1, are skipped.
+func archivedTables(db *sql.DB, specs []TableSpec) ([]string, error) {
+	rows, err := db.Query(`
+SELECT name FROM sqlite_master
+WHERE type = 'table' AND name NOT LIKE '\_arklite\_%' ESCAPE '\' AND name NOT LIKE 'sqlite\_%' ESCAPE '\'
+ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, spec := range specs {
+		matched := false
+		for _, table := range tables {
+			ok, err := path.Match(spec.Name, table)
+			if err != nil {
+				return nil, fmt.Errorf("bad table pattern %q: %w", spec.Name, err)
+			}
+			if ok {
+				matched = true
+				if !slices.Contains(result, table) {
+					result = append(result, table)
+				}
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no table matching %s found in the archive", spec.Name)
+		}
+	}
+	return result, nil
+}
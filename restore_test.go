@@ -0,0 +1,97 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRenameCreateTable(t *testing.T) {
+	createTable := "CREATE TABLE `orders` (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n)"
+	want := "CREATE TABLE `orders_restored` (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n)"
+	if got := renameCreateTable(createTable, "orders_restored"); got != want {
+		t.Errorf("renameCreateTable() = %q, want %q", got, want)
+	}
+}
+
+func TestRestoreQueries(t *testing.T) {
+	r := NewRestorer(nil, nil, "orders", RestorerOptions{Where: []string{"id > 10"}, Limit: 5})
+	r.columns = []*ColumnInfo{{name: "id"}, {name: "total"}}
+
+	if got, want := r.SQLiteSelectQuery(), "SELECT \n\"id\", \"total\"\nFROM \"orders\"\nWHERE id > 10\nLIMIT 5\n"; got != want {
+		t.Errorf("SQLiteSelectQuery() = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		onConflict string
+		want       string
+	}{
+		{OnConflictFail, "INSERT INTO `orders`(`id`, `total`) \nVALUES (?, ?), (?, ?) \n"},
+		{OnConflictIgnore, "INSERT IGNORE INTO `orders`(`id`, `total`) \nVALUES (?, ?), (?, ?) \n"},
+		{OnConflictReplace, "INSERT INTO `orders`(`id`, `total`) \nVALUES (?, ?), (?, ?) \nON DUPLICATE KEY UPDATE\n`id` = VALUES(`id`),\n`total` = VALUES(`total`)\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.onConflict, func(t *testing.T) {
+			r.opts.OnConflict = tt.onConflict
+			if got := r.MySQLInsertQuery(2); got != tt.want {
+				t.Errorf("MySQLInsertQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestoreStatementRows(t *testing.T) {
+	tests := []struct {
+		batchSize int
+		columns   int
+		want      int
+	}{
+		{10000, 2, 10000},
+		{10000, 8, 8191},
+		{10000, 65535, 1},
+		{100, 8, 100},
+	}
+	for _, tt := range tests {
+		r := NewRestorer(nil, nil, "orders", RestorerOptions{BatchSize: tt.batchSize})
+		r.columns = make([]*ColumnInfo, tt.columns)
+		got := r.statementRows()
+		if got != tt.want {
+			t.Errorf("statementRows() with batch of %d and %d columns = %d, want %d", tt.batchSize, tt.columns, got, tt.want)
+		}
+		if got*tt.columns > maxPlaceholders {
+			t.Errorf("%d rows of %d columns go over the placeholders limit", got, tt.columns)
+		}
+	}
+}
+
+func TestArchivedTables(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	for _, query := range []string{
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY AUTOINCREMENT, total REAL)",
+		"CREATE INDEX orders_total ON orders (total)",
+		"INSERT INTO orders (total) VALUES (1), (2)",
+		"CREATE TABLE order_items (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE _arklite_meta (id INTEGER PRIMARY KEY)",
+		"ANALYZE",
+	} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := archivedTables(db, []TableSpec{{Name: "*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"order_items", "orders"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("archivedTables(*) = %v, want %v", got, want)
+	}
+}
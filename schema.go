@@ -3,15 +3,23 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"reflect"
 	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/stephenafamo/bob"
 	"github.com/stephenafamo/bob/dialect/mysql"
+	"github.com/stephenafamo/bob/dialect/mysql/dm"
 	"github.com/stephenafamo/bob/dialect/mysql/sm"
 	"github.com/stephenafamo/bob/dialect/sqlite"
 	"github.com/stephenafamo/bob/dialect/sqlite/im"
+	ssm "github.com/stephenafamo/bob/dialect/sqlite/sm"
+	"github.com/stephenafamo/bob/expr"
 )
 
 type ColumnInfo struct {
@@ -19,44 +27,149 @@ type ColumnInfo struct {
 	mysqlType   string
 	sqliteType  string
 	reflectType reflect.Type
+	// Details from information_schema, dataType is lowercase like "decimal"
+	// and columnType is the full definition like "decimal(12,2) unsigned"
+	dataType   string
+	columnType string
+	precision  int
+	scale      int
+	// format is the storage format chosen by TypeMapping, empty for types with a single one
+	format string
+	// zeroDate and location are set for temporal columns, location is nil when values are kept as is
+	zeroDate string
+	location *time.Location
+	// charset and collation of string columns, empty for others
+	charset   string
+	collation string
+	// Constraints as information_schema shows them, generated is the expression of generated columns
+	nullable     bool
+	defaultValue sql.NullString
+	extra        string
+	generated    string
 }
 
 type Schema struct {
 	Table     string
 	Partition string
 	Where     []string
-	IdColumn  string
+	IdColumns []string
 	Columns   []*ColumnInfo
+	Indexes   []*IndexInfo
+	Checks    []*CheckInfo
+	// CreateTable is the original MySQL definition as SHOW CREATE TABLE shows it, partitions included
+	CreateTable string
+	// AutoIncrement and WithoutRowid are options of SQLite table, see CheckSQLiteTable
+	AutoIncrement bool
+	WithoutRowid  bool
+	// IdIndex is the index used to paginate by id columns, nil when there is none
+	IdIndex *IndexInfo
 }
 
-func ReadSchema(db *sql.DB, table string, partition string, where []string, idColumn string, onlyColumns []string, excludeColumns []string) (*Schema, error) {
+func ReadSchema(db *sql.DB, table string, partition string, where []string, idColumns []string, onlyColumns []string, excludeColumns []string, mapping TypeMapping) (*Schema, error) {
 	columnInfos, err := fetchColumnsInfo(db, table, onlyColumns, excludeColumns)
 	if err != nil {
 		return nil, err
 	}
+	if err := fetchColumnDetails(db, table, columnInfos); err != nil {
+		return nil, err
+	}
+	if err := applyTypeMapping(table, columnInfos, mapping); err != nil {
+		return nil, err
+	}
 
-	idColumnExists := false
+	for _, idColumn := range idColumns {
+		idColumnExists := false
+
+		for _, column := range columnInfos {
+			if column.name == idColumn {
+				idColumnExists = true
+			}
+		}
 
-	for _, column := range columnInfos {
-		if column.name == idColumn {
-			idColumnExists = true
+		if !idColumnExists {
+			return nil, fmt.Errorf("id column %s not found in table %s", idColumn, table)
 		}
 	}
 
-	if !idColumnExists {
-		return nil, fmt.Errorf("id column %s not found in table %s", idColumn, table)
+	indexes, err := fetchIndexes(db, table)
+	if err != nil {
+		return nil, err
+	}
+	checks, err := fetchChecks(db, table)
+	if err != nil {
+		return nil, err
+	}
+	createTable, err := fetchCreateTable(db, table)
+	if err != nil {
+		return nil, err
 	}
 
 	schema := &Schema{
-		Table:     table,
-		Columns:   columnInfos,
-		Partition: partition,
-		IdColumn:  idColumn,
-		Where:     where,
+		Table:       table,
+		Columns:     columnInfos,
+		Partition:   partition,
+		IdColumns:   idColumns,
+		Where:       where,
+		Indexes:     indexes,
+		Checks:      checks,
+		CreateTable: createTable,
+		IdIndex:     idIndex(indexes, idColumns),
 	}
 	return schema, nil
 }
 
+// UniqueIds tells if id columns identify rows, i.e. they include all columns of the primary key or
+// of a unique index over NOT NULL columns. Otherwise deleting rows by ids can hit rows never copied.
+func (s *Schema) UniqueIds() bool {
+	return slices.ContainsFunc(s.Indexes, func(index *IndexInfo) bool {
+		if !index.unique || index.nullable || index.expression || len(index.columns) == 0 {
+			return false
+		}
+		for _, column := range index.columns {
+			if !slices.Contains(s.IdColumns, column) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// SQLiteOrdersLikeMySQL tells if SQLite sorts id values as MySQL does. Strings of collations other
+// than binary ones and DECIMAL stored as TEXT sort differently.
+func (s *Schema) SQLiteOrdersLikeMySQL() bool {
+	for _, index := range s.IdColumnIndexes() {
+		column := s.Columns[index]
+		if column.collation != "" && column.collation != "binary" && !strings.HasSuffix(column.collation, "_bin") {
+			return false
+		}
+		if column.dataType == "decimal" && column.format != DecimalInteger && column.format != DecimalReal {
+			return false
+		}
+	}
+	return true
+}
+
+// HasTimestamp tells if a TIMESTAMP column is copied, its values depend on the session time zone.
+func (s *Schema) HasTimestamp() bool {
+	return slices.ContainsFunc(s.Columns, func(column *ColumnInfo) bool {
+		return column.dataType == "timestamp"
+	})
+}
+
+// IdIndexDescription describes how id columns are covered by an index.
+func (s *Schema) IdIndexDescription() string {
+	if s.IdIndex == nil {
+		return "not indexed"
+	}
+	if s.IdIndex.covers(s.IdColumns) < len(s.IdColumns) {
+		return fmt.Sprintf("partially indexed by %s (%s)", s.IdIndex.name, strings.Join(s.IdIndex.columns, ", "))
+	}
+	if s.IdIndex.primary() {
+		return "primary key"
+	}
+	return fmt.Sprintf("indexed by %s", s.IdIndex.name)
+}
+
 func (s *Schema) ColumnNames() []string {
 	result := make([]string, len(s.Columns))
 	for i, column := range s.Columns {
@@ -74,6 +187,94 @@ func (s *Schema) ColumnIndex(name string) int {
 	return -1
 }
 
+func (s *Schema) IdColumnIndexes() []int {
+	result := make([]int, len(s.IdColumns))
+	for i, idColumn := range s.IdColumns {
+		result[i] = s.ColumnIndex(idColumn)
+	}
+	return result
+}
+
+// RowCursor returns values of id columns of a scanned row.
+func (s *Schema) RowCursor(row RowData) (Cursor, error) {
+	cursor := make(Cursor, len(s.IdColumns))
+	for i, index := range s.IdColumnIndexes() {
+		if index == -1 {
+			return nil, fmt.Errorf("%s column not found", s.IdColumns[i])
+		}
+		value, err := cursorValue(row[index])
+		if err != nil {
+			return nil, fmt.Errorf("%s column: %w", s.IdColumns[i], err)
+		}
+		cursor[i] = value
+	}
+	return cursor, nil
+}
+
+// SqliteValues converts a scanned row into values to be inserted into SQLite.
+func (s *Schema) SqliteValues(row RowData) ([]any, error) {
+	values := make([]any, len(row))
+	for i, column := range s.Columns {
+		value, err := column.sqliteValue(row[i])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// SqliteKey converts a cursor into values of id columns as stored in SQLite.
+func (s *Schema) SqliteKey(cursor Cursor) (Cursor, error) {
+	if cursor == nil {
+		return nil, nil
+	}
+	key := make(Cursor, len(cursor))
+	for i, index := range s.IdColumnIndexes() {
+		value, err := s.Columns[index].sqliteValue(&cursor[i])
+		if err != nil {
+			return nil, err
+		}
+		// Values stored as they are come back as scanned
+		if scanned, ok := value.(*any); ok {
+			value = *scanned
+		}
+		key[i] = value
+	}
+	return key, nil
+}
+
+// MySQLKey converts values of id columns as stored in SQLite into a cursor to read MySQL from.
+func (s *Schema) MySQLKey(key Cursor) (Cursor, error) {
+	if key == nil {
+		return nil, nil
+	}
+	cursor := make(Cursor, len(key))
+	for i, index := range s.IdColumnIndexes() {
+		column := s.Columns[index]
+		value, err := column.mysqlValue(key[i])
+		if err != nil {
+			return nil, err
+		}
+		// Compared as a string MySQL would lose precision of large values
+		if text, ok := value.(string); ok && column.unsigned64() {
+			if value, err = strconv.ParseUint(text, 10, 64); err != nil {
+				return nil, err
+			}
+		}
+		cursor[i] = value
+	}
+	return cursor, nil
+}
+
+func (s *Schema) NewRow() RowData {
+	row := make(RowData, len(s.Columns))
+	for i, column := range s.Columns {
+		row[i] = reflect.New(column.reflectType).Interface()
+	}
+	return row
+}
+
 func (s *Schema) SqliteInsertQuery() string {
 	q := sqlite.Insert(
 		im.Into(sqlite.Quote(s.Table), s.ColumnNames()...),
@@ -87,9 +288,30 @@ func (s *Schema) SqliteInsertQuery() string {
 	return sql
 }
 
-func (s *Schema) MySQLSelectQuery(limit int64) string {
+// MySQLSelectQuery selects next batch of rows ordered by id columns.
+// With afterCursor rows are selected after the cursor given as keysetArgs,
+// otherwise from the very beginning.
+func (s *Schema) MySQLSelectQuery(limit int64, afterCursor bool) string {
+	return s.MySQLSelectRangeQuery(limit, afterCursor, nil)
+}
+
+// MySQLSelectRangeQuery is MySQLSelectQuery limited to a read range, range
+// arguments go after the cursor ones.
+func (s *Schema) MySQLSelectRangeQuery(limit int64, afterCursor bool, r *ReadRange) string {
+	return s.mysqlSelectQuery(limit, afterCursor, false, r)
+}
+
+// MySQLSelectUpToQuery is MySQLSelectQuery which stops at the cursor given as keysetArgs
+// after the one to start after, including the row of the cursor.
+func (s *Schema) MySQLSelectUpToQuery(limit int64, afterCursor bool) string {
+	return s.mysqlSelectQuery(limit, afterCursor, true, nil)
+}
+
+func (s *Schema) mysqlSelectQuery(limit int64, afterCursor bool, upTo bool, r *ReadRange) string {
 	from := sm.From(mysql.Quote(s.Table))
-	if s.Partition != "" {
+	if r != nil && len(r.Partitions) > 0 {
+		from = from.Partition(r.Partitions...)
+	} else if s.Partition != "" {
 		from = from.Partition(s.Partition)
 	}
 
@@ -101,15 +323,159 @@ func (s *Schema) MySQLSelectQuery(limit int64) string {
 	q := mysql.Select(
 		from,
 		sm.Columns(cols...),
-		sm.Where(mysql.Quote(s.IdColumn).GT(mysql.Placeholder(1))),
-		sm.OrderBy(mysql.Quote(s.IdColumn)).Asc(),
 		sm.Limit(limit),
 	)
 
-	if len(s.Where) > 0 {
-		for _, whereClause := range s.Where {
-			q.Apply(sm.Where(mysql.Raw(whereClause)))
+	if afterCursor {
+		q.Apply(sm.Where(mysql.Group(expr.Raw(keysetPredicate(s.IdColumns, quoteMySQL, true)))))
+	}
+	if upTo {
+		q.Apply(sm.Where(mysql.Group(expr.Raw(keysetPredicate(s.IdColumns, quoteMySQL, false)))))
+	}
+	if r != nil && r.Lower != nil {
+		q.Apply(sm.Where(mysql.Quote(s.IdColumns[0]).GTE(mysql.Placeholder(1))))
+	}
+	if r != nil && r.Upper != nil {
+		q.Apply(sm.Where(mysql.Quote(s.IdColumns[0]).LT(mysql.Placeholder(1))))
+	}
+	for _, idColumn := range s.IdColumns {
+		q.Apply(sm.OrderBy(mysql.Quote(idColumn)).Asc())
+	}
+
+	// Grouped, so OR can not escape the keyset and range bounds
+	for _, whereClause := range s.Where {
+		q.Apply(sm.Where(mysql.Group(mysql.Raw(whereClause))))
+	}
+
+	sql, _, err := q.Build(context.Background())
+	if err != nil {
+		return ""
+	}
+
+	return sql
+}
+
+// MySQLMinMaxQuery selects MIN and MAX of the leading id column of rows to be copied.
+func (s *Schema) MySQLMinMaxQuery() string {
+	from := sm.From(mysql.Quote(s.Table))
+	if s.Partition != "" {
+		from = from.Partition(s.Partition)
+	}
+
+	idColumn := quoteMySQL(s.IdColumns[0])
+	q := mysql.Select(
+		from,
+		sm.Columns(mysql.Raw(fmt.Sprintf("MIN(%s)", idColumn)), mysql.Raw(fmt.Sprintf("MAX(%s)", idColumn))),
+	)
+	for _, whereClause := range s.Where {
+		q.Apply(sm.Where(mysql.Group(mysql.Raw(whereClause))))
+	}
+
+	sql, _, err := q.Build(context.Background())
+	if err != nil {
+		return ""
+	}
+
+	return sql
+}
+
+// MySQLLastKeyQuery picks the largest of count cursors, each given as its index followed by its values,
+// and selects that index. Values are compared as MySQL compares the id columns, in their own collation.
+func (s *Schema) MySQLLastKeyQuery(count int) string {
+	values := make([]string, len(s.IdColumns)+1)
+	order := make([]string, len(s.IdColumns))
+	values[0] = "? AS `i`"
+	for i, index := range s.IdColumnIndexes() {
+		column := s.Columns[index]
+		value := "?"
+		switch {
+		case column.collation != "":
+			value = fmt.Sprintf("CONVERT(? USING %s) COLLATE %s", column.charset, column.collation)
+		case column.dataType == "decimal":
+			value = fmt.Sprintf("CAST(? AS DECIMAL(%d,%d))", column.precision, column.scale)
+		case column.dataType == "date":
+			value = "CAST(? AS DATE)"
+		case column.temporal():
+			value = "CAST(? AS DATETIME(6))"
 		}
+		values[i+1] = fmt.Sprintf("%s AS `k%d`", value, i)
+		order[i] = fmt.Sprintf("`k%d` DESC", i)
+	}
+	selects := make([]string, count)
+	for i := range selects {
+		selects[i] = "SELECT " + strings.Join(values, ", ")
+	}
+	return fmt.Sprintf(
+		"SELECT `i` FROM (%s) AS `cursors` ORDER BY %s LIMIT 1",
+		strings.Join(selects, " UNION ALL "), strings.Join(order, ", "),
+	)
+}
+
+func (s *Schema) MySQLDeleteQuery(count int) string {
+	var partitions []string
+	if s.Partition != "" {
+		partitions = append(partitions, s.Partition)
+	}
+
+	q := mysql.Delete(
+		dm.From(mysql.Quote(s.Table), partitions...),
+	)
+
+	if len(s.IdColumns) == 1 {
+		q.Apply(dm.Where(mysql.Quote(s.IdColumns[0]).In(mysql.Placeholder(uint(count)))))
+	} else {
+		keys := make([]bob.Expression, len(s.IdColumns))
+		for i, idColumn := range s.IdColumns {
+			keys[i] = mysql.Quote(idColumn)
+		}
+		tuples := make([]bob.Expression, count)
+		for i := range tuples {
+			tuples[i] = mysql.Group(mysql.Placeholder(uint(len(s.IdColumns))))
+		}
+		q.Apply(dm.Where(mysql.Group(keys...).In(tuples...)))
+	}
+	// Rows not matching --where may share ids with the copied ones. Grouped, so OR can not widen the delete
+	for _, whereClause := range s.Where {
+		q.Apply(dm.Where(mysql.Group(mysql.Raw(whereClause))))
+	}
+
+	sql, _, err := q.Build(context.Background())
+	if err != nil {
+		return ""
+	}
+
+	return sql
+}
+
+func (s *Schema) SQLiteCountIdsQuery(count int) string {
+	return s.sqliteIdsQuery(count, sqlite.Raw("COUNT(*)"))
+}
+
+// SQLiteSelectIdsQuery selects rows with any of count ids, in no particular order.
+func (s *Schema) SQLiteSelectIdsQuery(count int) string {
+	cols := make([]any, len(s.Columns))
+	for i, column := range s.Columns {
+		cols[i] = sqlite.Quote(column.name)
+	}
+	return s.sqliteIdsQuery(count, cols...)
+}
+
+func (s *Schema) sqliteIdsQuery(count int, columns ...any) string {
+	q := sqlite.Select(
+		ssm.Columns(columns...),
+		ssm.From(sqlite.Quote(s.Table)),
+	)
+
+	if len(s.IdColumns) == 1 {
+		q.Apply(ssm.Where(sqlite.Quote(s.IdColumns[0]).In(sqlite.Placeholder(uint(count)))))
+	} else {
+		keys := make([]bob.Expression, len(s.IdColumns))
+		for i, idColumn := range s.IdColumns {
+			keys[i] = sqlite.Quote(idColumn)
+		}
+		tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(s.IdColumns)), ", ") + ")"
+		values := "VALUES " + strings.TrimSuffix(strings.Repeat(tuple+", ", count), ", ")
+		q.Apply(ssm.Where(sqlite.Group(keys...).In(expr.Raw(values))))
 	}
 
 	sql, _, err := q.Build(context.Background())
@@ -120,27 +486,186 @@ func (s *Schema) MySQLSelectQuery(limit int64) string {
 	return sql
 }
 
+// SQLiteCountRangeQuery counts rows, optionally after one cursor and up to and
+// including another, both given as keysetArgs in that order.
+func (s *Schema) SQLiteCountRangeQuery(after bool, upTo bool) string {
+	q := sqlite.Select(
+		ssm.Columns(sqlite.Raw("COUNT(*)")),
+		ssm.From(sqlite.Quote(s.Table)),
+	)
+	if after {
+		q.Apply(ssm.Where(sqlite.Group(expr.Raw(keysetPredicate(s.IdColumns, quoteSQLite, true)))))
+	}
+	if upTo {
+		q.Apply(ssm.Where(sqlite.Group(expr.Raw(keysetPredicate(s.IdColumns, quoteSQLite, false)))))
+	}
+
+	sql, _, err := q.Build(context.Background())
+	if err != nil {
+		return ""
+	}
+
+	return sql
+}
+
+// SQLitePrimaryKey returns columns of MySQL primary key to mirror in SQLite,
+// nil when the table has none or some of its columns are not copied.
+func (s *Schema) SQLitePrimaryKey() []string {
+	for _, index := range s.Indexes {
+		if index.primary() && index.sqliteUnsupported(s) == "" {
+			return index.columns
+		}
+	}
+	return nil
+}
+
+// CheckSQLiteTable checks SQLite table options can be used with the primary key.
+func (s *Schema) CheckSQLiteTable() error {
+	primaryKey := s.SQLitePrimaryKey()
+	if s.AutoIncrement {
+		if len(primaryKey) != 1 || s.Columns[s.ColumnIndex(primaryKey[0])].sqliteType != "INTEGER" {
+			return fmt.Errorf("AUTOINCREMENT needs a primary key of a single INTEGER column, table %s has (%s)", s.Table, strings.Join(primaryKey, ", "))
+		}
+		if s.WithoutRowid {
+			return errors.New("AUTOINCREMENT is not possible on WITHOUT ROWID tables")
+		}
+	}
+	if s.WithoutRowid && primaryKey == nil {
+		return fmt.Errorf("WITHOUT ROWID needs a primary key, table %s has none", s.Table)
+	}
+	return nil
+}
+
+// SQLiteCreateTableQuery creates SQLite table with the same primary key as MySQL
+// one. See SQLiteCreateIdIndexQuery for tables where it does not cover id columns.
 func (s *Schema) SQLiteCreateTableQuery() string {
 	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n", sqlite.Quote(s.Table))
 
+	primaryKey := s.SQLitePrimaryKey()
+	autoIncrement := s.AutoIncrement && len(primaryKey) == 1
+
+	// Whatever SQLite can not express is kept in comments, SQLite keeps them in sqlite_schema
+	for _, check := range s.Checks {
+		if _, err := check.sqliteClause(s); err != nil {
+			query += fmt.Sprintf("  /* MySQL CHECK %s %s */\n", check.name, sqliteComment(check.clause))
+		}
+	}
+
 	columns := make([]string, len(s.Columns))
 	for i, columnInfo := range s.Columns {
 		columns[i] = fmt.Sprintf("  %s %s", sqlite.Quote(columnInfo.name), columnInfo.sqliteType)
-		if columnInfo.name == s.IdColumn {
+		constraints, notes := columnInfo.sqliteConstraints()
+		if constraints != "" {
+			columns[i] += " " + constraints
+		}
+		// AUTOINCREMENT is only possible in a column definition
+		if autoIncrement && columnInfo.name == primaryKey[0] {
 			columns[i] += " PRIMARY KEY AUTOINCREMENT"
 		}
+		if len(notes) > 0 {
+			columns[i] += fmt.Sprintf(" /* MySQL %s */", sqliteComment(strings.Join(notes, "; ")))
+		}
+	}
+	if primaryKey != nil && !autoIncrement {
+		keys := make([]string, len(primaryKey))
+		for i, column := range primaryKey {
+			keys[i] = sqlite.Quote(column).String()
+		}
+		columns = append(columns, fmt.Sprintf("  PRIMARY KEY (%s)", strings.Join(keys, ", ")))
+	}
+	for _, check := range s.Checks {
+		if clause, err := check.sqliteClause(s); err == nil {
+			columns = append(columns, fmt.Sprintf("  CONSTRAINT %s CHECK (%s)", sqlite.Quote(check.name), clause))
+		}
 	}
 	query += strings.Join(columns, ",\n")
 	query += "\n)"
+	if s.WithoutRowid && primaryKey != nil {
+		query += " WITHOUT ROWID"
+	}
 	return query
 }
 
-func sqliteType(mysqlType string) string {
+// SQLiteCreateIdIndexQuery indexes id columns when they are not the leading
+// columns of the primary key, empty string means no index is needed.
+func (s *Schema) SQLiteCreateIdIndexQuery() string {
+	primaryKey := s.SQLitePrimaryKey()
+	if len(primaryKey) >= len(s.IdColumns) && slices.Equal(primaryKey[:len(s.IdColumns)], s.IdColumns) {
+		return ""
+	}
+	// Keep uniqueness of the MySQL index id columns were taken from
+	unique := slices.ContainsFunc(s.Indexes, func(index *IndexInfo) bool {
+		return index.unique && slices.Equal(index.columns, s.IdColumns)
+	})
+	return s.SQLiteCreateIndexQuery(&IndexInfo{name: "arklite_id", unique: unique, columns: s.IdColumns})
+}
+
+// sqliteComment makes text safe to put into /* */ comment.
+func sqliteComment(text string) string {
+	return strings.ReplaceAll(text, "*/", "* /")
+}
+
+// SQLiteIndexes returns secondary indexes of the MySQL table which can be
+// recreated in SQLite, warning about those which can not be.
+func (s *Schema) SQLiteIndexes() []*IndexInfo {
+	var indexes []*IndexInfo
+	for _, index := range s.Indexes {
+		// Id columns are indexed by the primary key or by SQLiteCreateIdIndexQuery already
+		if index.primary() || slices.Equal(index.columns, s.IdColumns) {
+			continue
+		}
+		if reason := index.sqliteUnsupported(s); reason != "" {
+			slog.Warn("Skipping index", "table", s.Table, "index", index.name, "reason", reason)
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	return indexes
+}
+
+// SQLiteCreateIndexQuery creates index in SQLite. Index names are global in SQLite,
+// so they are prefixed with the table name.
+func (s *Schema) SQLiteCreateIndexQuery(index *IndexInfo) string {
+	columns := make([]string, len(index.columns))
+	for i, column := range index.columns {
+		columns[i] = quoteSQLite(column)
+	}
+	unique := ""
+	if index.unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf(
+		"CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)",
+		unique, quoteSQLite(s.Table+"_"+index.name), quoteSQLite(s.Table), strings.Join(columns, ", "),
+	)
+}
+
+func quoteMySQL(name string) string {
+	return mysql.Quote(name).String()
+}
+
+func quoteSQLite(name string) string {
+	return sqlite.Quote(name).String()
+}
+
+// sqliteType maps MySQL type to SQLite one, format is the storage format
+// chosen by TypeMapping or empty for the default one.
+func sqliteType(mysqlType string, format string) string {
 	// Map MySQL types to SQLite types
 	// SQLite has a simple type system: TEXT, INTEGER, REAL, BLOB
 	// Use substring matching to handle type modifiers like UNSIGNED, ZEROFILL, etc.
 	typeUpper := strings.ToUpper(mysqlType)
 
+	// Unsigned 64-bit integers which may not fit into INTEGER
+	if strings.Contains(typeUpper, "BIGINT") && strings.Contains(typeUpper, "UNSIGNED") {
+		switch format {
+		case UnsignedText:
+			return "TEXT"
+		case UnsignedBlob:
+			return "BLOB"
+		}
+	}
+
 	// Integer types (check more specific types first)
 	if strings.Contains(typeUpper, "TINYINT") || strings.Contains(typeUpper, "SMALLINT") ||
 		strings.Contains(typeUpper, "MEDIUMINT") || strings.Contains(typeUpper, "BIGINT") ||
@@ -149,9 +674,20 @@ func sqliteType(mysqlType string) string {
 		return "INTEGER"
 	}
 
+	// Fixed point types, kept exact unless asked otherwise
+	if strings.Contains(typeUpper, "DECIMAL") || strings.Contains(typeUpper, "NUMERIC") {
+		switch format {
+		case DecimalInteger:
+			return "INTEGER"
+		case DecimalReal:
+			return "REAL"
+		default:
+			return "TEXT"
+		}
+	}
+
 	// Floating point types
 	if strings.Contains(typeUpper, "FLOAT") || strings.Contains(typeUpper, "DOUBLE") ||
-		strings.Contains(typeUpper, "DECIMAL") || strings.Contains(typeUpper, "NUMERIC") ||
 		strings.Contains(typeUpper, "REAL") {
 		return "REAL"
 	}
@@ -167,7 +703,15 @@ func sqliteType(mysqlType string) string {
 		return "TEXT"
 	}
 
-	// Date/time types (SQLite stores as TEXT or INTEGER)
+	// Dates and times, ISO-8601 text unless asked otherwise. TIME and YEAR are always text.
+	if typeUpper == "DATE" || typeUpper == "DATETIME" || typeUpper == "TIMESTAMP" {
+		switch format {
+		case DatetimeUnix:
+			return "INTEGER"
+		case DatetimeJulian:
+			return "REAL"
+		}
+	}
 	if strings.Contains(typeUpper, "DATE") || strings.Contains(typeUpper, "TIME") ||
 		strings.Contains(typeUpper, "TIMESTAMP") || strings.Contains(typeUpper, "YEAR") {
 		return "TEXT"
@@ -229,7 +773,6 @@ func fetchColumnsInfo(db *sql.DB, table string, onlyColumns []string, excludeCol
 		result = append(result, &ColumnInfo{
 			name:        name,
 			mysqlType:   columnType,
-			sqliteType:  sqliteType(columnType),
 			reflectType: column.ScanType(),
 		})
 	}
@@ -241,6 +784,56 @@ func fetchColumnsInfo(db *sql.DB, table string, onlyColumns []string, excludeCol
 	return result, nil
 }
 
+// fetchColumnDetails fills in column details available only from information_schema.
+func fetchColumnDetails(db *sql.DB, table string, columns []*ColumnInfo) error {
+	rows, err := db.Query(`
+SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, NUMERIC_PRECISION, NUMERIC_SCALE, DATETIME_PRECISION,
+  IS_NULLABLE, COLUMN_DEFAULT, EXTRA, GENERATION_EXPRESSION, CHARACTER_SET_NAME, COLLATION_NAME
+FROM information_schema.COLUMNS
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, dataType, columnType, nullable, extra string
+		var precision, scale, fsp sql.NullInt64
+		var defaultValue, generated, charset, collation sql.NullString
+		if err := rows.Scan(
+			&name, &dataType, &columnType, &precision, &scale, &fsp,
+			&nullable, &defaultValue, &extra, &generated, &charset, &collation,
+		); err != nil {
+			return err
+		}
+		for _, column := range columns {
+			if column.name == name {
+				column.dataType = strings.ToLower(dataType)
+				column.columnType = columnType
+				column.precision = int(precision.Int64)
+				column.scale = int(scale.Int64)
+				// Fractional seconds digits of temporal columns
+				if fsp.Valid {
+					column.precision = int(fsp.Int64)
+				}
+				column.nullable = nullable == "YES"
+				column.defaultValue = defaultValue
+				column.extra = extra
+				column.generated = generated.String
+				column.charset = charset.String
+				column.collation = collation.String
+			}
+		}
+	}
+	return rows.Err()
+}
+
+func fetchCreateTable(db *sql.DB, table string) (string, error) {
+	var name, createTable string
+	err := db.QueryRow(fmt.Sprintf("SHOW CREATE TABLE %s", quoteMySQL(table))).Scan(&name, &createTable)
+	return createTable, err
+}
+
 func removeItem[T comparable](slice []T, item T) []T {
 	return slices.DeleteFunc(slice, func(t T) bool {
 		return t == item
@@ -253,7 +846,6 @@ func getColumnInfo(columnTypes []*sql.ColumnType, name string) *ColumnInfo {
 			return &ColumnInfo{
 				name:        column.Name(),
 				mysqlType:   column.DatabaseTypeName(),
-				sqliteType:  sqliteType(column.DatabaseTypeName()),
 				reflectType: column.ScanType(),
 			}
 		}
@@ -1,96 +1,308 @@
 package main
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestSqliteType(t *testing.T) {
 	tests := []struct {
 		name       string
 		mysqlType  string
+		format     string
 		wantSQLite string
 	}{
 		// Integer types
-		{"TINYINT", "TINYINT", "INTEGER"},
-		{"TINYINT UNSIGNED", "TINYINT UNSIGNED", "INTEGER"},
-		{"SMALLINT", "SMALLINT", "INTEGER"},
-		{"SMALLINT(5)", "SMALLINT(5)", "INTEGER"},
-		{"MEDIUMINT", "MEDIUMINT", "INTEGER"},
-		{"INT", "INT", "INTEGER"},
-		{"INT(11)", "INT(11)", "INTEGER"},
-		{"INT UNSIGNED", "INT UNSIGNED", "INTEGER"},
-		{"INTEGER", "INTEGER", "INTEGER"},
-		{"BIGINT", "BIGINT", "INTEGER"},
-		{"BIGINT(20) UNSIGNED", "BIGINT(20) UNSIGNED", "INTEGER"},
-		{"BOOL", "BOOL", "INTEGER"},
-		{"BOOLEAN", "BOOLEAN", "INTEGER"},
+		{"TINYINT", "TINYINT", "", "INTEGER"},
+		{"TINYINT UNSIGNED", "TINYINT UNSIGNED", "", "INTEGER"},
+		{"SMALLINT", "SMALLINT", "", "INTEGER"},
+		{"SMALLINT(5)", "SMALLINT(5)", "", "INTEGER"},
+		{"MEDIUMINT", "MEDIUMINT", "", "INTEGER"},
+		{"INT", "INT", "", "INTEGER"},
+		{"INT(11)", "INT(11)", "", "INTEGER"},
+		{"INT UNSIGNED", "INT UNSIGNED", "", "INTEGER"},
+		{"INTEGER", "INTEGER", "", "INTEGER"},
+		{"BIGINT", "BIGINT", "", "INTEGER"},
+		{"BIGINT(20) UNSIGNED", "BIGINT(20) UNSIGNED", "", "INTEGER"},
+		{"BIGINT UNSIGNED as integer", "BIGINT UNSIGNED", UnsignedInteger, "INTEGER"},
+		{"BIGINT UNSIGNED as text", "BIGINT UNSIGNED", UnsignedText, "TEXT"},
+		{"BIGINT UNSIGNED as blob", "UNSIGNED BIGINT", UnsignedBlob, "BLOB"},
+		{"INT UNSIGNED ignores unsigned format", "INT UNSIGNED", UnsignedText, "INTEGER"},
+		{"BOOL", "BOOL", "", "INTEGER"},
+		{"BOOLEAN", "BOOLEAN", "", "INTEGER"},
 
 		// Floating point types
-		{"FLOAT", "FLOAT", "REAL"},
-		{"FLOAT(7,4)", "FLOAT(7,4)", "REAL"},
-		{"DOUBLE", "DOUBLE", "REAL"},
-		{"DOUBLE PRECISION", "DOUBLE PRECISION", "REAL"},
-		{"DECIMAL", "DECIMAL", "REAL"},
-		{"DECIMAL(10,2)", "DECIMAL(10,2)", "REAL"},
-		{"NUMERIC", "NUMERIC", "REAL"},
-		{"REAL", "REAL", "REAL"},
+		{"FLOAT", "FLOAT", "", "REAL"},
+		{"FLOAT(7,4)", "FLOAT(7,4)", "", "REAL"},
+		{"DOUBLE", "DOUBLE", "", "REAL"},
+		{"DOUBLE PRECISION", "DOUBLE PRECISION", "", "REAL"},
+		{"REAL", "REAL", "", "REAL"},
+
+		// Fixed point types
+		{"DECIMAL", "DECIMAL", "", "TEXT"},
+		{"DECIMAL(10,2)", "DECIMAL(10,2)", "", "TEXT"},
+		{"NUMERIC", "NUMERIC", "", "TEXT"},
+		{"DECIMAL as text", "DECIMAL(10,2)", DecimalText, "TEXT"},
+		{"DECIMAL as integer", "DECIMAL(10,2)", DecimalInteger, "INTEGER"},
+		{"DECIMAL as real", "DECIMAL(10,2)", DecimalReal, "REAL"},
+		{"NUMERIC as integer", "NUMERIC(5,4)", DecimalInteger, "INTEGER"},
+		{"FLOAT ignores decimal format", "FLOAT", DecimalText, "REAL"},
 
 		// Binary types
-		{"BLOB", "BLOB", "BLOB"},
-		{"TINYBLOB", "TINYBLOB", "BLOB"},
-		{"MEDIUMBLOB", "MEDIUMBLOB", "BLOB"},
-		{"LONGBLOB", "LONGBLOB", "BLOB"},
-		{"BINARY", "BINARY", "BLOB"},
-		{"BINARY(16)", "BINARY(16)", "BLOB"},
-		{"VARBINARY", "VARBINARY", "BLOB"},
-		{"VARBINARY(255)", "VARBINARY(255)", "BLOB"},
+		{"BLOB", "BLOB", "", "BLOB"},
+		{"TINYBLOB", "TINYBLOB", "", "BLOB"},
+		{"MEDIUMBLOB", "MEDIUMBLOB", "", "BLOB"},
+		{"LONGBLOB", "LONGBLOB", "", "BLOB"},
+		{"BINARY", "BINARY", "", "BLOB"},
+		{"BINARY(16)", "BINARY(16)", "", "BLOB"},
+		{"VARBINARY", "VARBINARY", "", "BLOB"},
+		{"VARBINARY(255)", "VARBINARY(255)", "", "BLOB"},
 
 		// Text types
-		{"CHAR", "CHAR", "TEXT"},
-		{"CHAR(10)", "CHAR(10)", "TEXT"},
-		{"VARCHAR", "VARCHAR", "TEXT"},
-		{"VARCHAR(255)", "VARCHAR(255)", "TEXT"},
-		{"TEXT", "TEXT", "TEXT"},
-		{"TINYTEXT", "TINYTEXT", "TEXT"},
-		{"MEDIUMTEXT", "MEDIUMTEXT", "TEXT"},
-		{"LONGTEXT", "LONGTEXT", "TEXT"},
-		{"ENUM", "ENUM('a','b','c')", "TEXT"},
-		{"SET", "SET('x','y','z')", "TEXT"},
+		{"CHAR", "CHAR", "", "TEXT"},
+		{"CHAR(10)", "CHAR(10)", "", "TEXT"},
+		{"VARCHAR", "VARCHAR", "", "TEXT"},
+		{"VARCHAR(255)", "VARCHAR(255)", "", "TEXT"},
+		{"TEXT", "TEXT", "", "TEXT"},
+		{"TINYTEXT", "TINYTEXT", "", "TEXT"},
+		{"MEDIUMTEXT", "MEDIUMTEXT", "", "TEXT"},
+		{"LONGTEXT", "LONGTEXT", "", "TEXT"},
+		{"ENUM", "ENUM('a','b','c')", "", "TEXT"},
+		{"SET", "SET('x','y','z')", "", "TEXT"},
 
 		// Date/time types
-		{"DATE", "DATE", "TEXT"},
-		{"TIME", "TIME", "TEXT"},
-		{"DATETIME", "DATETIME", "TEXT"},
-		{"TIMESTAMP", "TIMESTAMP", "TEXT"},
-		{"YEAR", "YEAR", "TEXT"},
-		{"YEAR(4)", "YEAR(4)", "TEXT"},
+		{"DATE", "DATE", "", "TEXT"},
+		{"TIME", "TIME", "", "TEXT"},
+		{"DATETIME", "DATETIME", "", "TEXT"},
+		{"TIMESTAMP", "TIMESTAMP", "", "TEXT"},
+		{"DATETIME as iso", "DATETIME", DatetimeISO, "TEXT"},
+		{"DATETIME as unix", "DATETIME", DatetimeUnix, "INTEGER"},
+		{"TIMESTAMP as julian", "TIMESTAMP", DatetimeJulian, "REAL"},
+		{"DATE as unix", "DATE", DatetimeUnix, "INTEGER"},
+		{"TIME ignores datetime format", "TIME", DatetimeUnix, "TEXT"},
+		{"YEAR", "YEAR", "", "TEXT"},
+		{"YEAR(4)", "YEAR(4)", "", "TEXT"},
 
 		// JSON type
-		{"JSON", "JSON", "TEXT"},
+		{"JSON", "JSON", "", "TEXT"},
 
 		// Case insensitivity
-		{"lowercase int", "int", "INTEGER"},
-		{"lowercase varchar", "varchar(100)", "TEXT"},
-		{"lowercase blob", "blob", "BLOB"},
-		{"UPPERCASE INT", "INT", "INTEGER"},
-		{"MixedCase Int", "Int", "INTEGER"},
-		{"MixedCase VarChar", "VarChar(50)", "TEXT"},
+		{"lowercase int", "int", "", "INTEGER"},
+		{"lowercase varchar", "varchar(100)", "", "TEXT"},
+		{"lowercase blob", "blob", "", "BLOB"},
+		{"UPPERCASE INT", "INT", "", "INTEGER"},
+		{"MixedCase Int", "Int", "", "INTEGER"},
+		{"MixedCase VarChar", "VarChar(50)", "", "TEXT"},
 
 		// Type with modifiers
-		{"INT UNSIGNED ZEROFILL", "INT UNSIGNED ZEROFILL", "INTEGER"},
-		{"BIGINT AUTO_INCREMENT", "BIGINT AUTO_INCREMENT", "INTEGER"},
-		{"VARCHAR CHARSET utf8mb4", "VARCHAR(255) CHARACTER SET utf8mb4", "TEXT"},
+		{"INT UNSIGNED ZEROFILL", "INT UNSIGNED ZEROFILL", "", "INTEGER"},
+		{"BIGINT AUTO_INCREMENT", "BIGINT AUTO_INCREMENT", "", "INTEGER"},
+		{"VARCHAR CHARSET utf8mb4", "VARCHAR(255) CHARACTER SET utf8mb4", "", "TEXT"},
 
 		// Unknown types (should default to TEXT)
-		{"UNKNOWN", "UNKNOWN", "TEXT"},
-		{"CUSTOM_TYPE", "CUSTOM_TYPE", "TEXT"},
-		{"", "", "TEXT"},
+		{"UNKNOWN", "UNKNOWN", "", "TEXT"},
+		{"CUSTOM_TYPE", "CUSTOM_TYPE", "", "TEXT"},
+		{"", "", "", "TEXT"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := sqliteType(tt.mysqlType)
+			got := sqliteType(tt.mysqlType, tt.format)
 			if got != tt.wantSQLite {
-				t.Errorf("sqliteType(%q) = %q, want %q", tt.mysqlType, got, tt.wantSQLite)
+				t.Errorf("sqliteType(%q, %q) = %q, want %q", tt.mysqlType, tt.format, got, tt.wantSQLite)
 			}
 		})
 	}
 }
+
+func TestMySQLDeleteQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		partition string
+		idColumns []string
+		where     []string
+		count     int
+		want      string
+	}{
+		{"single id", "", []string{"id"}, nil, 1, "DELETE FROM `orders`\nWHERE (`id` IN (?))"},
+		{"chunk", "", []string{"id"}, nil, 3, "DELETE FROM `orders`\nWHERE (`id` IN (?, ?, ?))"},
+		{"partition", "p_old", []string{"id"}, nil, 2, "DELETE FROM `orders` PARTITION (p_old)\nWHERE (`id` IN (?, ?))"},
+		{"composite", "", []string{"tenant_id", "id"}, nil, 2, "DELETE FROM `orders`\nWHERE ((`tenant_id`, `id`) IN ((?, ?), (?, ?)))"},
+		{"where", "", []string{"id"}, []string{"status = 'done'", "created_at < '2020-01-01' OR archived"}, 1, "DELETE FROM `orders`\nWHERE (`id` IN (?)) AND (status = 'done') AND (created_at < '2020-01-01' OR archived)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Schema{Table: "orders", Partition: tt.partition, IdColumns: tt.idColumns, Where: tt.where}
+			got := strings.TrimSpace(s.MySQLDeleteQuery(tt.count))
+			if got != tt.want {
+				t.Errorf("MySQLDeleteQuery(%d) = %q, want %q", tt.count, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeysetQueries(t *testing.T) {
+	s := &Schema{
+		Table:     "orders",
+		IdColumns: []string{"tenant_id", "id"},
+		Columns:   []*ColumnInfo{{name: "tenant_id"}, {name: "id"}},
+	}
+
+	got := strings.TrimSpace(s.MySQLSelectQuery(10, true))
+	want := "SELECT \n`tenant_id`, `id`\nFROM `orders`\nWHERE (`tenant_id` >= ? AND (`tenant_id` > ? OR (`tenant_id` = ? AND `id` > ?)))\nORDER BY `tenant_id` ASC, `id` ASC\nLIMIT 10"
+	if got != want {
+		t.Errorf("MySQLSelectQuery() = %q, want %q", got, want)
+	}
+
+	s.Where = []string{"status = 'done' OR archived = 1"}
+	got = strings.TrimSpace(s.MySQLSelectQuery(10, true))
+	want = "SELECT \n`tenant_id`, `id`\nFROM `orders`\nWHERE (`tenant_id` >= ? AND (`tenant_id` > ? OR (`tenant_id` = ? AND `id` > ?))) AND (status = 'done' OR archived = 1)\nORDER BY `tenant_id` ASC, `id` ASC\nLIMIT 10"
+	if got != want {
+		t.Errorf("MySQLSelectQuery() with --where = %q, want %q", got, want)
+	}
+	got = strings.TrimSpace(s.MySQLMinMaxQuery())
+	want = "SELECT \nMIN(`tenant_id`), MAX(`tenant_id`)\nFROM `orders`\nWHERE (status = 'done' OR archived = 1)"
+	if got != want {
+		t.Errorf("MySQLMinMaxQuery() = %q, want %q", got, want)
+	}
+	s.Where = nil
+
+	got = strings.TrimSpace(s.SQLiteCountIdsQuery(2))
+	want = "SELECT \nCOUNT(*)\nFROM \"orders\"\nWHERE ((\"tenant_id\", \"id\") IN (VALUES (?, ?), (?, ?)))"
+	if got != want {
+		t.Errorf("SQLiteCountIdsQuery() = %q, want %q", got, want)
+	}
+}
+
+func TestSQLiteCreateTableQuery(t *testing.T) {
+	columns := []*ColumnInfo{
+		{name: "id", sqliteType: "INTEGER"},
+		{name: "created_at", sqliteType: "TEXT"},
+		{name: "code", sqliteType: "TEXT"},
+	}
+	primary := &IndexInfo{name: "PRIMARY", unique: true, columns: []string{"id", "created_at"}}
+	singlePrimary := &IndexInfo{name: "PRIMARY", unique: true, columns: []string{"id"}}
+	uniqueCode := &IndexInfo{name: "u_code", unique: true, columns: []string{"code"}}
+
+	tests := []struct {
+		name          string
+		indexes       []*IndexInfo
+		idColumns     []string
+		autoIncrement bool
+		withoutRowid  bool
+		wantKey       string
+		wantIdIndex   string
+		wantErr       bool
+	}{
+		{
+			"composite primary key", []*IndexInfo{primary}, []string{"id"}, false, false,
+			`  PRIMARY KEY ("id", "created_at")` + "\n)", "", false,
+		},
+		{
+			"without rowid", []*IndexInfo{primary}, []string{"id", "created_at"}, false, true,
+			`  PRIMARY KEY ("id", "created_at")` + "\n) WITHOUT ROWID", "", false,
+		},
+		{
+			"autoincrement", []*IndexInfo{singlePrimary}, []string{"id"}, true, false,
+			`  "id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT`, "", false,
+		},
+		{"autoincrement on composite key", []*IndexInfo{primary}, []string{"id"}, true, false, "", "", true},
+		{
+			"id columns not in primary key", []*IndexInfo{singlePrimary, uniqueCode}, []string{"code"}, false, false,
+			`  PRIMARY KEY ("id")` + "\n)", `CREATE UNIQUE INDEX IF NOT EXISTS "orders_arklite_id" ON "orders" ("code")`, false,
+		},
+		{
+			"no primary key", []*IndexInfo{uniqueCode}, []string{"code"}, false, false,
+			`  "code" TEXT NOT NULL` + "\n)", `CREATE UNIQUE INDEX IF NOT EXISTS "orders_arklite_id" ON "orders" ("code")`, false,
+		},
+		{"without rowid and no primary key", []*IndexInfo{uniqueCode}, []string{"code"}, false, true, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Schema{
+				Table:         "orders",
+				IdColumns:     tt.idColumns,
+				Columns:       columns,
+				Indexes:       tt.indexes,
+				AutoIncrement: tt.autoIncrement,
+				WithoutRowid:  tt.withoutRowid,
+			}
+			err := s.CheckSQLiteTable()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckSQLiteTable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := s.SQLiteCreateTableQuery(); !strings.Contains(got, tt.wantKey) {
+				t.Errorf("SQLiteCreateTableQuery() = %q, want it to contain %q", got, tt.wantKey)
+			}
+			if got := s.SQLiteCreateIdIndexQuery(); got != tt.wantIdIndex {
+				t.Errorf("SQLiteCreateIdIndexQuery() = %q, want %q", got, tt.wantIdIndex)
+			}
+		})
+	}
+}
+
+func TestUniqueIds(t *testing.T) {
+	indexes := []*IndexInfo{
+		{name: "PRIMARY", unique: true, columns: []string{"id"}},
+		{name: "u_order", unique: true, columns: []string{"tenant_id", "number"}},
+		{name: "u_email", unique: true, columns: []string{"email"}, nullable: true},
+		{name: "idx_created", columns: []string{"created_at"}},
+	}
+	tests := []struct {
+		idColumns []string
+		want      bool
+	}{
+		{[]string{"id"}, true},
+		{[]string{"tenant_id", "number"}, true},
+		{[]string{"created_at", "id"}, true},
+		{[]string{"tenant_id"}, false},
+		{[]string{"email"}, false},
+		{[]string{"created_at"}, false},
+	}
+	for _, tt := range tests {
+		s := &Schema{IdColumns: tt.idColumns, Indexes: indexes}
+		if got := s.UniqueIds(); got != tt.want {
+			t.Errorf("UniqueIds() with id columns %v = %v, want %v", tt.idColumns, got, tt.want)
+		}
+	}
+}
+
+func TestIdOrder(t *testing.T) {
+	columns := []*ColumnInfo{
+		{name: "id", dataType: "int"},
+		{name: "code", dataType: "varchar", charset: "utf8mb4", collation: "utf8mb4_0900_ai_ci"},
+		{name: "sku", dataType: "varchar", charset: "utf8mb4", collation: "utf8mb4_bin"},
+		{name: "amount", dataType: "decimal", precision: 10, scale: 2},
+		{name: "cents", dataType: "decimal", precision: 10, scale: 2, format: DecimalInteger},
+		{name: "created_at", dataType: "datetime"},
+	}
+	tests := []struct {
+		idColumns []string
+		want      bool
+	}{
+		{[]string{"id"}, true},
+		{[]string{"sku", "created_at"}, true},
+		{[]string{"cents"}, true},
+		{[]string{"id", "code"}, false},
+		{[]string{"amount"}, false},
+	}
+	for _, tt := range tests {
+		s := &Schema{IdColumns: tt.idColumns, Columns: columns}
+		if got := s.SQLiteOrdersLikeMySQL(); got != tt.want {
+			t.Errorf("SQLiteOrdersLikeMySQL() with id columns %v = %v, want %v", tt.idColumns, got, tt.want)
+		}
+	}
+
+	s := &Schema{Table: "orders", IdColumns: []string{"code", "amount", "created_at"}, Columns: columns}
+	got := s.MySQLLastKeyQuery(2)
+	values := "? AS `i`, CONVERT(? USING utf8mb4) COLLATE utf8mb4_0900_ai_ci AS `k0`, CAST(? AS DECIMAL(10,2)) AS `k1`, CAST(? AS DATETIME(6)) AS `k2`"
+	want := "SELECT `i` FROM (SELECT " + values + " UNION ALL SELECT " + values + ") AS `cursors` ORDER BY `k0` DESC, `k1` DESC, `k2` DESC LIMIT 1"
+	if got != want {
+		t.Errorf("MySQLLastKeyQuery() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var outputPlaceholders = []string{"{table}", "{yyyy}", "{mm}", "{dd}", "{n}"}
+
+var outputPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// OutputTemplate is --output path which may split the output into shards with placeholders:
+// {table} for the table name, {yyyy}, {mm} and {dd} for the date of the shard column
+// and {n} for the shard number.
+type OutputTemplate string
+
+func (t OutputTemplate) Check() error {
+	for _, placeholder := range outputPlaceholder.FindAllString(string(t), -1) {
+		if !slices.Contains(outputPlaceholders, placeholder) {
+			return fmt.Errorf("unknown placeholder %s, expected one of %s", placeholder, strings.Join(outputPlaceholders, ", "))
+		}
+	}
+	return nil
+}
+
+func (t OutputTemplate) Sharded() bool {
+	return outputPlaceholder.MatchString(string(t))
+}
+
+// ByTime tells if rows are split by the date of the shard column.
+func (t OutputTemplate) ByTime() bool {
+	return strings.Contains(string(t), "{yyyy}") || strings.Contains(string(t), "{mm}") || strings.Contains(string(t), "{dd}")
+}
+
+// Numbered tells if shards are split by size.
+func (t OutputTemplate) Numbered() bool {
+	return strings.Contains(string(t), "{n}")
+}
+
+// Path of the shard with the given number for the date as yyyy-mm-dd.
+func (t OutputTemplate) Path(table string, date string, n int) string {
+	return strings.NewReplacer(
+		"{table}", table,
+		"{yyyy}", date[:4],
+		"{mm}", date[5:7],
+		"{dd}", date[8:10],
+		"{n}", fmt.Sprintf("%04d", n),
+	).Replace(string(t))
+}
+
+type ShardOptions struct {
+	Template OutputTemplate
+	// Column is the DATE, DATETIME or TIMESTAMP column which dates route rows to shards
+	Column string
+	// MaxRows and MaxBytes start the next {n} shard once one of them is reached
+	MaxRows  uint64
+	MaxBytes uint64
+	Force    bool
+	// Created are the files made by this run, tables without {table} in the template share them
+	Created map[string]bool
+	Config  string
+	// Durable syncs every commit to disk, rows are purged from MySQL right after it
+	Durable bool
+	Indexes bool
+	// Host and Database go into the manifest of every shard
+	Host     string
+	Database string
+}
+
+// Check makes sure the template and the limits fit each other.
+func (o *ShardOptions) Check() error {
+	if err := o.Template.Check(); err != nil {
+		return err
+	}
+	if o.Template.ByTime() && o.Column == "" {
+		return fmt.Errorf("%s needs --shard-column to take dates from", o.Template)
+	}
+	if !o.Template.ByTime() && o.Column != "" {
+		return fmt.Errorf("--shard-column needs {yyyy}, {mm} or {dd} in %s", o.Template)
+	}
+	limited := o.MaxRows > 0 || o.MaxBytes > 0
+	if o.Template.Numbered() && !limited {
+		return fmt.Errorf("%s needs --shard-rows or --shard-size to start the next shard", o.Template)
+	}
+	if !o.Template.Numbered() && limited {
+		return fmt.Errorf("--shard-rows and --shard-size need {n} in %s", o.Template)
+	}
+	return nil
+}
+
+// maxOpenShards is how many shards of a table are kept open at once. Rows come in id order,
+// not in date order, so the least recently used shard is closed to open another one.
+const maxOpenShards = 16
+
+// shard is an output file with a complete archive of its part of the table.
+type shard struct {
+	path string
+	// db and target are nil while the shard is closed to keep others open
+	db       *sql.DB
+	target   *sqliteTarget
+	manifest *Manifest
+	run      *Run
+	// rows routed to the shard so far, some of them may be not written yet
+	rows     uint64
+	full     bool
+	finished bool
+	// used is when the shard was last written to, by the clock of its shardSet
+	used uint64
+}
+
+// shardSet routes rows of a table to shards, creating them as they are needed.
+type shardSet struct {
+	opts   ShardOptions
+	schema *Schema
+	// column is the index of the shard column, -1 when rows are not split by time
+	column int
+	shards map[string]*shard
+	// numbers are current shard numbers of every date
+	numbers map[string]int
+	paths   []string
+	maxOpen int
+	clock   uint64
+	// purge records ids of written rows to purge them from MySQL
+	purge bool
+}
+
+func newShardSet(opts ShardOptions, s *Schema) (*shardSet, error) {
+	ss := &shardSet{
+		opts:    opts,
+		schema:  s,
+		column:  -1,
+		shards:  map[string]*shard{},
+		numbers: map[string]int{},
+		maxOpen: maxOpenShards,
+	}
+	if opts.Column != "" {
+		ss.column = slices.IndexFunc(s.Columns, func(column *ColumnInfo) bool { return column.name == opts.Column })
+		if ss.column == -1 {
+			return nil, fmt.Errorf("shard column %s is not copied from table %s", opts.Column, s.Table)
+		}
+		if !s.Columns[ss.column].temporal() {
+			return nil, fmt.Errorf("shard column %s is %s, not DATE, DATETIME or TIMESTAMP", opts.Column, s.Columns[ss.column].mysqlType)
+		}
+	}
+	return ss, nil
+}
+
+// Paths of all the shards written, in the order they were created.
+func (ss *shardSet) Paths() []string {
+	return ss.paths
+}
+
+// route picks the shard for a row. NULL and zero dates go to the 0000-00-00 shard.
+func (ss *shardSet) route(row RowData) (*shard, error) {
+	date := "0000-00-00"
+	if ss.column >= 0 {
+		value, err := scannedValue(row[ss.column])
+		if err != nil {
+			return nil, err
+		}
+		switch v := value.(type) {
+		case string:
+			if len(v) >= len(date) {
+				date = v[:len(date)]
+			}
+		case []byte:
+			if len(v) >= len(date) {
+				date = string(v[:len(date)])
+			}
+		}
+	}
+
+	n := max(ss.numbers[date], 1)
+	path := ss.opts.Template.Path(ss.schema.Table, date, n)
+	if sh := ss.shards[path]; sh != nil && sh.full {
+		n++
+		path = ss.opts.Template.Path(ss.schema.Table, date, n)
+	}
+	ss.numbers[date] = n
+
+	sh := ss.shards[path]
+	if sh == nil {
+		if err := ss.makeRoom(nil); err != nil {
+			return nil, err
+		}
+		var err error
+		if sh, err = ss.open(path); err != nil {
+			return nil, fmt.Errorf("shard %s: %w", path, err)
+		}
+		ss.clock++
+		sh.used = ss.clock
+		ss.shards[path] = sh
+		ss.paths = append(ss.paths, path)
+	}
+	sh.rows++
+	if ss.opts.MaxRows > 0 && sh.rows >= ss.opts.MaxRows {
+		sh.full = true
+	}
+	return sh, nil
+}
+
+// open creates a shard file with the table and everything an archive has along with it.
+func (ss *shardSet) open(path string) (*shard, error) {
+	if !ss.opts.Created[path] {
+		if _, err := os.Stat(path); err == nil {
+			if !ss.opts.Force {
+				return nil, fmt.Errorf("file already exists, use --force to overwrite")
+			}
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		}
+		ss.opts.Created[path] = true
+	}
+	slog.Info("Creating shard", "table", ss.schema.Table, "file", path)
+
+	db, err := ss.connect(path)
+	if err != nil {
+		return nil, err
+	}
+	sh := &shard{path: path, db: db}
+	err = func() error {
+		if err := createSQLiteTable(db, ss.schema); err != nil {
+			return err
+		}
+		if err := writeCheckpoint(db, NewCheckpoint(ss.schema)); err != nil {
+			return err
+		}
+		sh.manifest = NewManifest(ss.schema, ss.opts.Host, ss.opts.Database)
+		if err := startManifest(db, sh.manifest); err != nil {
+			return err
+		}
+		if sh.run, err = startRun(db, ss.schema, RunCopy, nil); err != nil {
+			return err
+		}
+		sh.target, err = newSQLiteTarget(db, ss.schema, ss.purge)
+		return err
+	}()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return sh, nil
+}
+
+func (ss *shardSet) connect(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", sqliteDSN(path, ss.opts.Durable))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(ss.opts.Config); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// use reopens the shard if it was closed to keep others open, rows are about to be written into it.
+func (ss *shardSet) use(sh *shard) error {
+	ss.clock++
+	sh.used = ss.clock
+	if sh.db != nil {
+		return nil
+	}
+	if err := ss.makeRoom(sh); err != nil {
+		return err
+	}
+	db, err := ss.connect(sh.path)
+	if err != nil {
+		return fmt.Errorf("shard %s: %w", sh.path, err)
+	}
+	if sh.target, err = newSQLiteTarget(db, ss.schema, ss.purge); err != nil {
+		db.Close()
+		return fmt.Errorf("shard %s: %w", sh.path, err)
+	}
+	sh.db = db
+	return nil
+}
+
+// makeRoom closes the least recently used shard when as many as allowed are open, so that one
+// more can be opened. The closed shard is finished later, it may have rows of the batch to write.
+func (ss *shardSet) makeRoom(keep *shard) error {
+	var open []*shard
+	for _, sh := range ss.shards {
+		if sh.db != nil && sh != keep {
+			open = append(open, sh)
+		}
+	}
+	if len(open) < ss.maxOpen {
+		return nil
+	}
+	lru := slices.MinFunc(open, func(a, b *shard) int { return cmp.Compare(a.used, b.used) })
+	// Rows are no longer routed to a shard which has grown full while open
+	if err := ss.checkSize(lru); err != nil {
+		return fmt.Errorf("shard %s: %w", lru.path, err)
+	}
+	lru.target.Close()
+	lru.target = nil
+	if err := lru.db.Close(); err != nil {
+		return fmt.Errorf("shard %s: %w", lru.path, err)
+	}
+	lru.db = nil
+	return nil
+}
+
+// checkSize marks the open shard full once its file reaches MaxBytes.
+func (ss *shardSet) checkSize(sh *shard) error {
+	if sh.full || ss.opts.MaxBytes == 0 {
+		return nil
+	}
+	size, err := sqliteSize(sh.db)
+	if err != nil {
+		return err
+	}
+	sh.full = size >= ss.opts.MaxBytes
+	return nil
+}
+
+// rollOver finishes shards which are full once their rows are written.
+func (ss *shardSet) rollOver() error {
+	for path, sh := range ss.shards {
+		if sh.db == nil {
+			continue
+		}
+		if err := ss.checkSize(sh); err != nil {
+			return err
+		}
+		if !sh.full {
+			continue
+		}
+		if err := ss.close(sh); err != nil {
+			return fmt.Errorf("shard %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// finish finishes all the shards not finished yet.
+func (ss *shardSet) finish() error {
+	for _, path := range ss.paths {
+		if sh := ss.shards[path]; !sh.finished {
+			if err := ss.close(sh); err != nil {
+				return fmt.Errorf("shard %s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// close finishes the shard, reopening it if it was closed to keep others open.
+func (ss *shardSet) close(sh *shard) error {
+	if sh.db == nil {
+		db, err := ss.connect(sh.path)
+		if err != nil {
+			return err
+		}
+		sh.db = db
+	} else {
+		sh.target.Close()
+		sh.target = nil
+	}
+	sh.finished = true
+	defer func() {
+		sh.db.Close()
+		sh.db = nil
+	}()
+
+	if ss.opts.Indexes {
+		if err := createSQLiteIndexes(sh.db, ss.schema); err != nil {
+			return err
+		}
+	}
+	if err := finishManifest(sh.db, ss.schema, sh.manifest); err != nil {
+		return err
+	}
+	if err := finishRun(sh.db, sh.run, sh.manifest.MaxId, sh.rows); err != nil {
+		return err
+	}
+	slog.Info("Shard finished", "table", ss.schema.Table, "file", sh.path, "rows", sh.rows)
+	return nil
+}
+
+func sqliteSize(db *sql.DB) (uint64, error) {
+	var size uint64
+	err := db.QueryRow("SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()").Scan(&size)
+	return size, err
+}
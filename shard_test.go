@@ -0,0 +1,173 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOutputTemplate(t *testing.T) {
+	template := OutputTemplate("archive/{table}-{yyyy}-{mm}-{dd}.{n}.sqlite")
+	if got, want := template.Path("orders", "2025-01-02", 3), "archive/orders-2025-01-02.0003.sqlite"; got != want {
+		t.Errorf("Path() = %q, want %q", got, want)
+	}
+	if !template.Sharded() || !template.ByTime() || !template.Numbered() {
+		t.Errorf("%s is sharded by time and numbered", template)
+	}
+	if OutputTemplate("orders.sqlite").Sharded() {
+		t.Error("orders.sqlite is not sharded")
+	}
+
+	tests := []struct {
+		name    string
+		opts    ShardOptions
+		wantErr bool
+	}{
+		{"by time", ShardOptions{Template: "orders-{yyyy}-{mm}.sqlite", Column: "created_at"}, false},
+		{"numbered", ShardOptions{Template: "orders-{n}.sqlite", MaxRows: 1000}, false},
+		{"numbered by size", ShardOptions{Template: "orders-{n}.sqlite", MaxBytes: 1 << 30}, false},
+		{"by time and numbered", ShardOptions{Template: "{table}-{yyyy}-{n}.sqlite", Column: "created_at", MaxRows: 10}, false},
+		{"unknown placeholder", ShardOptions{Template: "orders-{month}.sqlite", Column: "created_at"}, true},
+		{"no shard column", ShardOptions{Template: "orders-{yyyy}.sqlite"}, true},
+		{"shard column without dates", ShardOptions{Template: "orders-{n}.sqlite", Column: "created_at", MaxRows: 10}, true},
+		{"no limits", ShardOptions{Template: "orders-{n}.sqlite"}, true},
+		{"limits without number", ShardOptions{Template: "{table}.sqlite", MaxRows: 10}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Check(); (err != nil) != tt.wantErr {
+				t.Errorf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShardRoute(t *testing.T) {
+	dir := t.TempDir()
+	s := &Schema{
+		Table:     "orders",
+		IdColumns: []string{"id"},
+		Columns: []*ColumnInfo{
+			{name: "id", mysqlType: "INT", dataType: "int", sqliteType: "INTEGER"},
+			{name: "created_at", mysqlType: "DATETIME", dataType: "datetime", sqliteType: "TEXT"},
+		},
+	}
+	ss, err := newShardSet(ShardOptions{
+		Template: OutputTemplate(filepath.Join(dir, "{table}-{yyyy}-{mm}-{n}.sqlite")),
+		Column:   "created_at",
+		MaxRows:  2,
+		Created:  map[string]bool{},
+	}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, created := range []sql.NullString{
+		{String: "2025-01-31 10:00:00", Valid: true},
+		{String: "2025-02-01 10:00:00", Valid: true},
+		{String: "2025-01-31 11:00:00", Valid: true},
+		{String: "2025-01-31 12:00:00", Valid: true},
+		{},
+	} {
+		id := 0
+		sh, err := ss.route(RowData{&id, &created})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, filepath.Base(sh.path))
+		if err := ss.rollOver(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ss.finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"orders-2025-01-0001.sqlite",
+		"orders-2025-02-0001.sqlite",
+		"orders-2025-01-0001.sqlite",
+		"orders-2025-01-0002.sqlite",
+		"orders-0000-00-0001.sqlite",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("routed to %v, want %v", got, want)
+	}
+	if len(ss.Paths()) != 4 {
+		t.Errorf("Paths() = %v, want 4 shards", ss.Paths())
+	}
+}
+
+func TestShardsOpenAtOnce(t *testing.T) {
+	dir := t.TempDir()
+	s := &Schema{
+		Table:     "orders",
+		IdColumns: []string{"id"},
+		Columns: []*ColumnInfo{
+			{name: "id", mysqlType: "INT", dataType: "int", sqliteType: "INTEGER"},
+			{name: "created_at", mysqlType: "DATE", dataType: "date", sqliteType: "TEXT"},
+		},
+	}
+	ss, err := newShardSet(ShardOptions{
+		Template: OutputTemplate(filepath.Join(dir, "{table}-{yyyy}.sqlite")),
+		Column:   "created_at",
+		Created:  map[string]bool{},
+	}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.maxOpen = 2
+	writer := &shardWriter{copier: &Copier{schema: s, shards: ss}, shards: ss}
+
+	// Ids go up while years jump around, every batch touches three shards
+	years := []string{"2021", "2022", "2023", "2021", "2023", "2022"}
+	for id := range 12 {
+		var batch []copiedRow
+		for i := range 3 {
+			rowId := int64(id*3 + i)
+			created := sql.NullString{String: years[(id+i)%len(years)] + "-01-01", Valid: true}
+			batch = append(batch, copiedRow{row: RowData{&rowId, &created}})
+		}
+		if err := writer.WriteBatch(batch); err != nil {
+			t.Fatal(err)
+		}
+		open := 0
+		for _, sh := range ss.shards {
+			if sh.db != nil {
+				open++
+			}
+		}
+		if open > ss.maxOpen {
+			t.Fatalf("%d shards open, want at most %d", open, ss.maxOpen)
+		}
+	}
+	if err := writer.Finish(); err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, path := range ss.Paths() {
+		db, err := sql.Open("sqlite3", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var rows int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM "orders"`).Scan(&rows); err != nil {
+			t.Fatal(err)
+		}
+		manifest, err := readManifest(db, "orders")
+		db.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if manifest.FinishedAt.IsZero() || manifest.RowsCopied != uint64(rows) {
+			t.Errorf("%s has %d rows, manifest finished at %v with %d rows", filepath.Base(path), rows, manifest.FinishedAt, manifest.RowsCopied)
+		}
+		total += rows
+	}
+	if len(ss.Paths()) != 3 || total != 36 {
+		t.Errorf("%d rows written into %v, want 36 into 3 shards", total, ss.Paths())
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+type TableSpec struct {
+	Name      string
+	IdColumns []string
+}
+
+// parseIdColumns parses comma separated list of id columns.
+func parseIdColumns(value string) ([]string, error) {
+	idColumns := strings.Split(value, ",")
+	for i, idColumn := range idColumns {
+		idColumns[i] = strings.TrimSpace(idColumn)
+		if idColumns[i] == "" {
+			return nil, fmt.Errorf("empty id column in %q", value)
+		}
+	}
+	return idColumns, nil
+}
+
+// parseTableSpecs parses --table values in form of "table" or "table:id_column[,id_column...]".
+func parseTableSpecs(values []string, defaultIdColumns []string) ([]TableSpec, error) {
+	specs := make([]TableSpec, 0, len(values))
+	for _, value := range values {
+		name, idColumns, found := strings.Cut(strings.TrimSpace(value), ":")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("empty table name in %q", value)
+		}
+		spec := TableSpec{Name: name, IdColumns: defaultIdColumns}
+		if found {
+			var err error
+			spec.IdColumns, err = parseIdColumns(idColumns)
+			if err != nil {
+				return nil, err
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func isTablePattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// expandTableSpecs replaces glob patterns with matching tables from the database.
+// Tables listed explicitly are never taken from patterns, so their id column
+// overrides win, other tables matched more than once are kept at their first occurrence.
+func expandTableSpecs(db *sql.DB, specs []TableSpec) ([]TableSpec, error) {
+	var tables []string
+	if slices.ContainsFunc(specs, func(spec TableSpec) bool { return isTablePattern(spec.Name) }) {
+		var err error
+		tables, err = fetchTables(db)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	explicit := map[string]bool{}
+	for _, spec := range specs {
+		if !isTablePattern(spec.Name) {
+			explicit[spec.Name] = true
+		}
+	}
+
+	result := make([]TableSpec, 0, len(specs))
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		if !isTablePattern(spec.Name) {
+			if !seen[spec.Name] {
+				seen[spec.Name] = true
+				result = append(result, spec)
+			}
+			continue
+		}
+
+		matched := false
+		for _, table := range tables {
+			ok, err := path.Match(spec.Name, table)
+			if err != nil {
+				return nil, fmt.Errorf("bad table pattern %q: %w", spec.Name, err)
+			}
+			if !ok {
+				continue
+			}
+			matched = true
+			if !seen[table] && !explicit[table] {
+				seen[table] = true
+				result = append(result, TableSpec{Name: table, IdColumns: spec.IdColumns})
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no tables match %q", spec.Name)
+		}
+	}
+	return result, nil
+}
+
+func fetchTables(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+SELECT TABLE_NAME
+FROM information_schema.TABLES
+WHERE TABLE_SCHEMA = DATABASE() AND TABLE_TYPE = 'BASE TABLE'
+ORDER BY TABLE_NAME`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
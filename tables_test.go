@@ -0,0 +1,48 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTableSpecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []TableSpec
+		wantErr bool
+	}{
+		{"single table", []string{"orders"}, []TableSpec{{"orders", []string{"id"}}}, false},
+		{"id column override", []string{"orders:order_id"}, []TableSpec{{"orders", []string{"order_id"}}}, false},
+		{
+			"several tables",
+			[]string{"orders:order_id", "order_items", "payments:payment_id"},
+			[]TableSpec{
+				{"orders", []string{"order_id"}},
+				{"order_items", []string{"id"}},
+				{"payments", []string{"payment_id"}},
+			},
+			false,
+		},
+		{"composite id", []string{"orders:tenant_id,id"}, []TableSpec{{"orders", []string{"tenant_id", "id"}}}, false},
+		{"pattern", []string{"order_*:order_id"}, []TableSpec{{"order_*", []string{"order_id"}}}, false},
+		{"spaces", []string{" orders : tenant_id , id "}, []TableSpec{{"orders", []string{"tenant_id", "id"}}}, false},
+		{"empty table", []string{":order_id"}, nil, true},
+		{"empty id column", []string{"orders:"}, nil, true},
+		{"empty composite id column", []string{"orders:tenant_id,"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTableSpecs(tt.values, []string{"id"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTableSpecs(%q) error = %v, wantErr %v", tt.values, err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.EqualFunc(got, tt.want, func(a, b TableSpec) bool {
+				return a.Name == b.Name && slices.Equal(a.IdColumns, b.IdColumns)
+			}) {
+				t.Errorf("parseTableSpecs(%q) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
@@ -12,9 +12,10 @@ import sys
 import mysql.connector
 import sqlite3
 import os
+from datetime import timezone
 
 
-def run_arklite() -> None:
+def run_arklite(output: str = "./tmp/out.db", *args: str) -> None:
     cmd = [
         "go",
         "run",
@@ -23,8 +24,9 @@ def run_arklite() -> None:
         "-pdevpass",
         "-ddevdb",
         "-tdevtable",
-        "-o./tmp/out.db",
+        f"-o{output}",
         "-f",  # Force overwrite
+        *args,
     ]
     result = subprocess.run(cmd, capture_output=True, text=True, cwd=os.getcwd())
     if result.returncode != 0:
@@ -178,7 +180,7 @@ def verify_row_by_row(mysql_cnx, sqlite_cnx) -> bool:
                     mysql_str = mysql_val
                 elif hasattr(mysql_val, "isoformat"):
                     # MySQL datetime object - convert to string format matching SQLite
-                    mysql_str = mysql_val.strftime("%Y-%m-%d %H:%M:%S+00:00")
+                    mysql_str = mysql_val.strftime("%Y-%m-%d %H:%M:%S")
                 else:
                     mysql_str = str(mysql_val)
 
@@ -270,6 +272,63 @@ def verify_row_by_row(mysql_cnx, sqlite_cnx) -> bool:
     return True
 
 
+def verify_datetime_format(mysql_cnx, datetime_format: str) -> bool:
+    """Verify DATETIME values stored with --datetime unix or julian."""
+    db_path = f"./tmp/out_{datetime_format}.db"
+    run_arklite(db_path, f"--datetime={datetime_format}")
+    sqlite_cnx = get_sqlite_connection(db_path)
+
+    mysql_cursor = mysql_cnx.cursor()
+    mysql_cursor.execute("SELECT id, datetime_column FROM devtable ORDER BY id")
+    mysql_rows = mysql_cursor.fetchall()
+    mysql_cursor.close()
+
+    sqlite_cursor = sqlite_cnx.cursor()
+    sqlite_cursor.execute(
+        "SELECT id, datetime_column, typeof(datetime_column) FROM devtable ORDER BY id"
+    )
+    sqlite_rows = sqlite_cursor.fetchall()
+    sqlite_cursor.close()
+    sqlite_cnx.close()
+
+    if len(mysql_rows) != len(sqlite_rows):
+        print(
+            f"Error: --datetime {datetime_format} row counts do not match "
+            f"(MySQL: {len(mysql_rows)}, SQLite: {len(sqlite_rows)})"
+        )
+        return False
+
+    expected_type = "integer" if datetime_format == "unix" else "real"
+    mismatches = 0
+    for (row_id, mysql_val), (_, sqlite_val, sqlite_type) in zip(
+        mysql_rows, sqlite_rows
+    ):
+        seconds = mysql_val.replace(tzinfo=timezone.utc).timestamp()
+        if datetime_format == "unix":
+            expected = int(seconds)
+            ok = sqlite_val == expected
+        else:
+            # Julian day of the Unix epoch
+            expected = seconds / 86400 + 2440587.5
+            ok = abs(sqlite_val - expected) < 0.000001
+        if sqlite_type != expected_type or not ok:
+            mismatches += 1
+            print(
+                f"Error: --datetime {datetime_format}, row {row_id}: "
+                f"MySQL={mysql_val}, expected {expected}, "
+                f"SQLite={sqlite_val} ({sqlite_type})"
+            )
+
+    if mismatches > 0:
+        print(
+            f"Error: Found {mismatches} row(s) with mismatches for --datetime {datetime_format}"
+        )
+        return False
+
+    print(f"All {len(mysql_rows)} rows match with --datetime {datetime_format}")
+    return True
+
+
 def main() -> None:
     run_arklite()
 
@@ -286,6 +345,10 @@ def main() -> None:
         if not verify_types(sqlite_cnx):
             sys.exit(1)
 
+        for datetime_format in ("unix", "julian"):
+            if not verify_datetime_format(mysql_cnx, datetime_format):
+                sys.exit(1)
+
         print("All tests ok")
 
     finally:
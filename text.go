@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encodings of binary values in CSV and JSON Lines
+const (
+	BinaryBase64 = "base64"
+	BinaryHex    = "hex"
+)
+
+var binaryEncodings = []string{BinaryBase64, BinaryHex}
+
+var textCompressions = []string{"none", "gzip", "zstd"}
+
+// TextWriter writes rows of a table into a CSV or JSON Lines file, optionally compressed,
+// with a sidecar file describing the columns. Like ParquetWriter, the file is written
+// next to the path and moved into place once it is complete.
+type TextWriter struct {
+	path       string
+	file       *os.File
+	compressor io.WriteCloser
+	buffer     *bufio.Writer
+	csv        *csv.Writer
+	schema     *Schema
+	opts       FileOptions
+	rows       uint64
+}
+
+// TextSchema is the sidecar file of CSV and JSON Lines output, written next to it as <output>.schema.json.
+type TextSchema struct {
+	Table       string       `json:"table"`
+	Format      string       `json:"format"`
+	Compression string       `json:"compression"`
+	IdColumns   []string     `json:"id_columns"`
+	Columns     []TextColumn `json:"columns"`
+	// Null is how CSV writes NULL values
+	Null *string `json:"null,omitempty"`
+	Rows uint64  `json:"rows"`
+}
+
+type TextColumn struct {
+	Name string `json:"name"`
+	// Type is the MySQL column type, e.g. decimal(12,2) unsigned
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	// Encoding tells how values are written, see textEncoding
+	Encoding string `json:"encoding"`
+}
+
+func NewTextWriter(path string, s *Schema, opts FileOptions) (*TextWriter, error) {
+	w := &TextWriter{path: path, schema: s, opts: opts}
+	var err error
+	if w.file, err = os.Create(path + ".partial"); err != nil {
+		return nil, err
+	}
+	var out io.Writer = w.file
+	switch opts.Compression {
+	case "gzip":
+		w.compressor = gzip.NewWriter(w.file)
+	case "zstd":
+		if w.compressor, err = zstd.NewWriter(w.file); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	if w.compressor != nil {
+		out = w.compressor
+	}
+	w.buffer = bufio.NewWriter(out)
+
+	if opts.Format == FormatCSV {
+		w.csv = csv.NewWriter(w.buffer)
+		if err := w.csv.Write(s.ColumnNames()); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// NewTextSchema describes how the columns of the table are written.
+func NewTextSchema(s *Schema, opts FileOptions) *TextSchema {
+	ts := &TextSchema{
+		Table:       s.Table,
+		Format:      opts.Format,
+		Compression: opts.Compression,
+		IdColumns:   s.IdColumns,
+	}
+	if opts.Format == FormatCSV {
+		ts.Null = &opts.Null
+	}
+	for _, column := range s.Columns {
+		ts.Columns = append(ts.Columns, TextColumn{
+			Name:     column.name,
+			Type:     column.columnType,
+			Nullable: column.nullable,
+			Encoding: column.textEncoding(opts.Binary),
+		})
+	}
+	return ts
+}
+
+func (w *TextWriter) WriteBatch(batch []copiedRow) error {
+	batchStartAt := time.Now()
+	record := make([]string, len(w.schema.Columns))
+	var line bytes.Buffer
+	for _, copied := range batch {
+		line.Reset()
+		line.WriteByte('{')
+		for i, column := range w.schema.Columns {
+			value, err := scannedValue(copied.row[i])
+			if err != nil {
+				return err
+			}
+			if value != nil {
+				if value, err = column.exportValue(value, w.opts.Binary); err != nil {
+					return err
+				}
+			}
+
+			if w.csv != nil {
+				record[i] = csvField(value, w.opts.Null)
+				continue
+			}
+			if i > 0 {
+				line.WriteByte(',')
+			}
+			name, err := json.Marshal(column.name)
+			if err != nil {
+				return err
+			}
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return fmt.Errorf("column %s: %w", column.name, err)
+			}
+			line.Write(name)
+			line.WriteByte(':')
+			line.Write(encoded)
+		}
+
+		if w.csv != nil {
+			if err := w.csv.Write(record); err != nil {
+				return err
+			}
+			continue
+		}
+		line.WriteString("}\n")
+		if _, err := w.buffer.Write(line.Bytes()); err != nil {
+			return err
+		}
+	}
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	w.rows += uint64(len(batch))
+
+	count, suffix := humanize.ComputeSI(float64(len(batch)))
+	slog.Debug(
+		"Batch written to file",
+		"batch_duration", time.Since(batchStartAt),
+		"batch_size", fmt.Sprintf("%d%s", int(count), suffix),
+	)
+	return nil
+}
+
+// Finish flushes the file, moves it into place and writes the sidecar with the columns next to it.
+func (w *TextWriter) Finish() error {
+	if err := w.buffer.Flush(); err != nil {
+		return err
+	}
+	if w.compressor != nil {
+		if err := w.compressor.Close(); err != nil {
+			return err
+		}
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	if err := os.Rename(w.path+".partial", w.path); err != nil {
+		return err
+	}
+
+	ts := NewTextSchema(w.schema, w.opts)
+	ts.Rows = w.rows
+	sidecar, err := json.MarshalIndent(ts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(w.path+".schema.json", append(sidecar, '\n'), 0o644)
+}
+
+// Close removes the file unless it was finished.
+func (w *TextWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	w.file.Close()
+	w.file = nil
+	return os.Remove(w.path + ".partial")
+}
+
+func csvField(value any, null string) string {
+	switch v := value.(type) {
+	case nil:
+		return null
+	case string:
+		return v
+	case json.RawMessage:
+		return string(v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// textEncoding tells how values of the column are written:
+// integer, float, decimal (as string), date, datetime (local time), timestamp (UTC),
+// base64 or hex for binary columns, json or string.
+func (c *ColumnInfo) textEncoding(binary string) string {
+	switch {
+	case c.integer() || c.dataType == "year":
+		return "integer"
+	case c.dataType == "float" || c.dataType == "double" || c.dataType == "real":
+		return "float"
+	case c.dataType == "decimal":
+		return "decimal"
+	case c.dataType == "date":
+		return "date"
+	case c.temporal() && c.dataType == "datetime" && c.location == nil:
+		return "datetime"
+	case c.temporal():
+		return "timestamp"
+	case c.binary():
+		return binary
+	case c.dataType == "json":
+		return "json"
+	default:
+		return "string"
+	}
+}
+
+// exportValue converts non-NULL scanned MySQL value into what CSV and JSON Lines write:
+// integers and floats as numbers, decimals as strings to keep them exact, dates and times
+// in ISO-8601, binary values encoded and JSON as it is. Zero dates are NULL unless --zero-date asks otherwise.
+func (c *ColumnInfo) exportValue(value any, binary string) (any, error) {
+	switch c.textEncoding(binary) {
+	case "integer":
+		if c.unsigned() {
+			v, err := uintValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %w", c.name, err)
+			}
+			return v, nil
+		}
+		v, err := intValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.name, err)
+		}
+		return v, nil
+
+	case "float":
+		v, err := floatValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", c.name, err)
+		}
+		if c.dataType == "float" {
+			return float32(v), nil
+		}
+		return v, nil
+
+	case "date", "datetime", "timestamp":
+		return c.isoValue(textValue(value))
+
+	case BinaryBase64:
+		return base64.StdEncoding.EncodeToString([]byte(textValue(value))), nil
+
+	case BinaryHex:
+		return hex.EncodeToString([]byte(textValue(value))), nil
+
+	case "json":
+		if raw := []byte(textValue(value)); json.Valid(raw) {
+			return json.RawMessage(raw), nil
+		}
+		return textValue(value), nil
+
+	default:
+		return textValue(value), nil
+	}
+}
+
+// isoValue turns DATE, DATETIME or TIMESTAMP value as MySQL prints it into ISO-8601,
+// e.g. "2025-01-02T03:04:05.5Z". DATETIME values have no zone unless they are converted to UTC.
+func (c *ColumnInfo) isoValue(value string) (any, error) {
+	if zeroDate(value) {
+		switch c.zeroDate {
+		case ZeroDateKeep:
+			return value, nil
+		case ZeroDateError:
+			return nil, fmt.Errorf("zero date %s in column %s", value, c.name)
+		default:
+			return nil, nil
+		}
+	}
+	if c.dataType == "date" {
+		return value, nil
+	}
+
+	location := c.location
+	if location == nil {
+		location = time.UTC
+	}
+	t, err := time.ParseInLocation(time.DateTime, value, location)
+	if err != nil {
+		return nil, fmt.Errorf("bad %s value in column %s: %w", strings.ToUpper(c.dataType), c.name, err)
+	}
+	layout := "2006-01-02T15:04:05"
+	if c.precision > 0 {
+		layout += "." + strings.Repeat("0", c.precision)
+	}
+	if c.dataType == "datetime" && c.location == nil {
+		return t.Format(layout), nil
+	}
+	return t.UTC().Format(layout + "Z"), nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExportValue(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		column *ColumnInfo
+		value  any
+		want   any
+	}{
+		{"unsigned", &ColumnInfo{dataType: "bigint", columnType: "bigint unsigned"}, uint64(18446744073709551615), uint64(18446744073709551615)},
+		{"small int", &ColumnInfo{dataType: "tinyint", columnType: "tinyint"}, int8(-5), int64(-5)},
+		{"float", &ColumnInfo{dataType: "float", columnType: "float"}, float32(1.1), float32(1.1)},
+		{"decimal", &ColumnInfo{dataType: "decimal", columnType: "decimal(30,10)"}, "-0.0000000001", "-0.0000000001"},
+		{"date", &ColumnInfo{dataType: "date", columnType: "date"}, "2025-01-02", "2025-01-02"},
+		{"local datetime", &ColumnInfo{dataType: "datetime", columnType: "datetime(3)", precision: 3}, "2025-01-02 03:04:05.5", "2025-01-02T03:04:05.500"},
+		{"converted datetime", &ColumnInfo{dataType: "datetime", columnType: "datetime", location: berlin}, "2025-01-02 03:04:05", "2025-01-02T02:04:05Z"},
+		{"timestamp", &ColumnInfo{dataType: "timestamp", columnType: "timestamp"}, "2025-01-02 03:04:05", "2025-01-02T03:04:05Z"},
+		{"zero date", &ColumnInfo{dataType: "datetime", columnType: "datetime", zeroDate: ZeroDateNull}, "0000-00-00 00:00:00", nil},
+		{"kept zero date", &ColumnInfo{dataType: "date", columnType: "date", zeroDate: ZeroDateKeep}, "0000-00-00", "0000-00-00"},
+		{"blob", &ColumnInfo{dataType: "blob", columnType: "blob"}, []byte{0, 255}, "AP8="},
+		{"json", &ColumnInfo{dataType: "json", columnType: "json"}, `{"a": 1}`, json.RawMessage(`{"a": 1}`)},
+		{"text", &ColumnInfo{dataType: "varchar", columnType: "varchar(10)"}, "abc", "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.column.exportValue(tt.value, BinaryBase64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exportValue(%v) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+
+	if got, _ := (&ColumnInfo{dataType: "varbinary", columnType: "varbinary(2)"}).exportValue([]byte{0, 255}, BinaryHex); got != "00ff" {
+		t.Errorf("hex = %v, want 00ff", got)
+	}
+	if _, err := (&ColumnInfo{dataType: "date", columnType: "date", zeroDate: ZeroDateError}).exportValue("2025-00-01", BinaryBase64); err == nil {
+		t.Error("zero date with --zero-date error, want error")
+	}
+}
+
+func TestTextWriter(t *testing.T) {
+	s := &Schema{
+		Table:     "orders",
+		IdColumns: []string{"id"},
+		Columns: []*ColumnInfo{
+			{name: "id", dataType: "int", columnType: "int", reflectType: reflect.TypeOf(int32(0))},
+			{name: "note", dataType: "varchar", columnType: "varchar(10)", nullable: true, reflectType: reflect.TypeOf(sql.NullString{})},
+			{name: "data", dataType: "blob", columnType: "blob", nullable: true, reflectType: reflect.TypeOf([]byte{})},
+		},
+	}
+	batch := make([]copiedRow, 2)
+	for i := range batch {
+		batch[i].row = s.NewRow()
+	}
+	*batch[0].row[0].(*int32) = 1
+	*batch[0].row[1].(*sql.NullString) = sql.NullString{String: "a, \"b\"", Valid: true}
+	*batch[0].row[2].(*[]byte) = []byte("hi")
+	*batch[1].row[0].(*int32) = 2
+
+	tests := []struct {
+		format      string
+		compression string
+		want        string
+	}{
+		{FormatCSV, "gzip", "id,note,data\n1,\"a, \"\"b\"\"\",aGk=\n2,\\N,\\N\n"},
+		{FormatJSONL, "none", "{\"id\":1,\"note\":\"a, \\\"b\\\"\",\"data\":\"aGk=\"}\n{\"id\":2,\"note\":null,\"data\":null}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "orders."+tt.format)
+			opts := FileOptions{Format: tt.format, Compression: tt.compression, Null: `\N`, Binary: BinaryBase64}
+			if err := opts.Check(); err != nil {
+				t.Fatal(err)
+			}
+			w, err := NewTextWriter(path, s, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+			if err := w.WriteBatch(batch); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Finish(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			var r io.Reader = f
+			if tt.compression == "gzip" {
+				if r, err = gzip.NewReader(f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("file = %q, want %q", got, tt.want)
+			}
+
+			var sidecar TextSchema
+			data, err := os.ReadFile(path + ".schema.json")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(data, &sidecar); err != nil {
+				t.Fatal(err)
+			}
+			wantColumns := []TextColumn{
+				{Name: "id", Type: "int", Encoding: "integer"},
+				{Name: "note", Type: "varchar(10)", Nullable: true, Encoding: "string"},
+				{Name: "data", Type: "blob", Nullable: true, Encoding: BinaryBase64},
+			}
+			if sidecar.Rows != 2 || sidecar.Compression != tt.compression || !reflect.DeepEqual(sidecar.Columns, wantColumns) {
+				t.Errorf("sidecar = %+v", sidecar)
+			}
+		})
+	}
+}
+
+func TestFileOptionsCheck(t *testing.T) {
+	tests := []struct {
+		opts    FileOptions
+		want    string
+		wantErr bool
+	}{
+		{FileOptions{Format: FormatParquet, Binary: BinaryBase64}, "snappy", false},
+		{FileOptions{Format: FormatCSV, Binary: BinaryBase64}, "none", false},
+		{FileOptions{Format: FormatJSONL, Compression: "zstd", Binary: BinaryHex}, "zstd", false},
+		{FileOptions{Format: FormatCSV, Compression: "snappy", Binary: BinaryBase64}, "", true},
+		{FileOptions{Format: FormatCSV, Binary: "base32"}, "", true},
+	}
+	for _, tt := range tests {
+		err := tt.opts.Check()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%+v: error = %v, wantErr %v", tt.opts, err, tt.wantErr)
+		}
+		if err == nil && tt.opts.Compression != tt.want {
+			t.Errorf("%+v: compression = %s, want %s", tt.opts, tt.opts.Compression, tt.want)
+		}
+	}
+}
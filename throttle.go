@@ -0,0 +1,229 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+type ThrottleOptions struct {
+	// MaxThreadsRunning pauses the copy while Threads_running of the source is above it, 0 disables the check
+	MaxThreadsRunning int
+	// MaxReplicaLag pauses the copy while any of the replicas lags behind more, 0 disables the check
+	MaxReplicaLag time.Duration
+	// HeartbeatTable is read on replicas instead of SHOW REPLICA STATUS when set,
+	// its ts column is the UTC time the source wrote the latest heartbeat at
+	HeartbeatTable string
+	// Interval is how long results of a check hold and how long to sleep before checking again when paused
+	Interval time.Duration
+}
+
+// Replica is a MySQL replica of the source which lag is checked.
+type Replica struct {
+	Name string
+	Db   *sql.DB
+}
+
+// Throttler pauses reads and deletes while the source is busy or replicas fall behind.
+// It is shared by parallel readers, all of them wait while it is paused.
+type Throttler struct {
+	source   *sql.DB
+	replicas []Replica
+	opts     ThrottleOptions
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	// pausedAt is when the current pause started, zero when not paused
+	pausedAt time.Time
+}
+
+func NewThrottler(source *sql.DB, replicas []Replica, opts ThrottleOptions) *Throttler {
+	return &Throttler{source: source, replicas: replicas, opts: opts}
+}
+
+// Wait returns once neither of the thresholds is exceeded or stopped tells the copy is over anyway.
+// A nil Throttler never waits.
+func (t *Throttler) Wait(stopped func() bool) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for !stopped() {
+		if t.pausedAt.IsZero() && time.Since(t.checkedAt) < t.opts.Interval {
+			return nil
+		}
+		reason, err := t.check()
+		if err != nil {
+			return fmt.Errorf("checking load: %w", err)
+		}
+		t.checkedAt = time.Now()
+		if reason == "" {
+			if !t.pausedAt.IsZero() {
+				slog.Info("Load is back to normal, resuming", "paused_for", time.Since(t.pausedAt).Round(time.Millisecond))
+				t.pausedAt = time.Time{}
+			}
+			return nil
+		}
+
+		if t.pausedAt.IsZero() {
+			t.pausedAt = time.Now()
+			slog.Warn("Throttling, pausing until load is back to normal", "reason", reason)
+		} else {
+			slog.Debug("Still throttling", "reason", reason)
+		}
+		time.Sleep(t.opts.Interval)
+	}
+	return nil
+}
+
+// check tells why the copy should pause, empty when it should not.
+func (t *Throttler) check() (string, error) {
+	if t.opts.MaxThreadsRunning > 0 {
+		running, err := threadsRunning(t.source)
+		if err != nil {
+			return "", err
+		}
+		if running > t.opts.MaxThreadsRunning {
+			return fmt.Sprintf("Threads_running is %d, above %d", running, t.opts.MaxThreadsRunning), nil
+		}
+	}
+	if t.opts.MaxReplicaLag > 0 {
+		for _, replica := range t.replicas {
+			var lag sql.Null[time.Duration]
+			var err error
+			if t.opts.HeartbeatTable != "" {
+				lag, err = heartbeatLag(replica.Db, t.opts.HeartbeatTable)
+			} else {
+				lag, err = replicaLag(replica.Db)
+			}
+			if err != nil {
+				return "", fmt.Errorf("replica %s: %w", replica.Name, err)
+			}
+			if !lag.Valid {
+				return fmt.Sprintf("replication on %s is not running", replica.Name), nil
+			}
+			if lag.V > t.opts.MaxReplicaLag {
+				return fmt.Sprintf("replica %s lags %s behind, above %s", replica.Name, lag.V.Round(time.Millisecond), t.opts.MaxReplicaLag), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+func threadsRunning(db *sql.DB) (int, error) {
+	var name, value string
+	if err := db.QueryRow("SHOW GLOBAL STATUS LIKE 'Threads_running'").Scan(&name, &value); err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// replicaLag reads Seconds_Behind_Source of SHOW REPLICA STATUS, falling back to
+// SHOW SLAVE STATUS of MySQL before 8.0.22. Multi-source replicas have a row per channel,
+// the lag is the largest of them. NULL means replication of some channel is not running.
+func replicaLag(db *sql.DB) (sql.Null[time.Duration], error) {
+	var lag sql.Null[time.Duration]
+	rows, err := db.Query("SHOW REPLICA STATUS")
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1064 {
+		rows, err = db.Query("SHOW SLAVE STATUS")
+	}
+	if err != nil {
+		return lag, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return lag, err
+	}
+	lagColumn := slices.IndexFunc(columns, func(column string) bool {
+		return column == "Seconds_Behind_Source" || column == "Seconds_Behind_Master"
+	})
+	if lagColumn < 0 {
+		return lag, errors.New("SHOW REPLICA STATUS has no Seconds_Behind_Source")
+	}
+	values := make([]sql.NullString, len(columns))
+	scanned := make([]any, len(columns))
+	for i := range values {
+		scanned[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(scanned...); err != nil {
+			return lag, err
+		}
+		value := values[lagColumn]
+		if !value.Valid {
+			return sql.Null[time.Duration]{}, nil
+		}
+		seconds, err := strconv.ParseInt(value.String, 10, 64)
+		if err != nil {
+			return lag, fmt.Errorf("bad %s %q: %w", columns[lagColumn], value.String, err)
+		}
+		lag = sql.Null[time.Duration]{V: max(lag.V, time.Duration(seconds)*time.Second), Valid: true}
+	}
+	if err := rows.Err(); err != nil {
+		return lag, err
+	}
+	if !lag.Valid {
+		return lag, errors.New("SHOW REPLICA STATUS is empty, it is not a replica")
+	}
+	return lag, nil
+}
+
+// heartbeatLag is how long ago the latest heartbeat, e.g. of pt-heartbeat --utc, was written
+// according to the replica clock. An empty table means replication is not running.
+func heartbeatLag(db *sql.DB, table string) (sql.Null[time.Duration], error) {
+	var lag sql.Null[int64]
+	query := fmt.Sprintf("SELECT TIMESTAMPDIFF(MICROSECOND, MAX(`ts`), UTC_TIMESTAMP(6)) FROM %s", quoteMySQLTable(table))
+	if err := db.QueryRow(query).Scan(&lag); err != nil {
+		return sql.Null[time.Duration]{}, err
+	}
+	return sql.Null[time.Duration]{V: time.Duration(max(lag.V, 0)) * time.Microsecond, Valid: lag.Valid}, nil
+}
+
+// quoteMySQLTable quotes table name which may be qualified with the database, like db.table.
+func quoteMySQLTable(table string) string {
+	database, name, found := strings.Cut(table, ".")
+	if !found {
+		return quoteMySQL(table)
+	}
+	return quoteMySQL(database) + "." + quoteMySQL(name)
+}
+
+// parseReplica reads --replica value, either a full DSN like user:password@tcp(host:3306)/
+// or host[:port] connected to with the source credentials. Both use TLS of the source
+// unless the DSN has its own tls parameter. Sessions are in UTC, like ts of the heartbeat table.
+func parseReplica(value string, source *mysql.Config) (*mysql.Config, error) {
+	if strings.Contains(value, "@") || strings.Contains(value, "(") {
+		config, err := mysql.ParseDSN(value)
+		if err != nil {
+			return nil, err
+		}
+		if config.TLSConfig == "" {
+			config.TLSConfig = source.TLSConfig
+			config.AllowFallbackToPlaintext = source.AllowFallbackToPlaintext
+		}
+		return utcSession(config), nil
+	}
+	if value == "" {
+		return nil, errors.New("empty replica address")
+	}
+	config := utcSession(source)
+	config.Net = "tcp"
+	config.Addr = value
+	if !strings.Contains(value, ":") {
+		config.Addr = value + ":3306"
+	}
+	return config, nil
+}
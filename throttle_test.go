@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestParseReplica(t *testing.T) {
+	source := &mysql.Config{User: "archiver", Passwd: "secret", Net: "tcp", Addr: "primary:3306", DBName: "shop"}
+	tests := []struct {
+		value    string
+		wantUser string
+		wantAddr string
+		wantDb   string
+		wantErr  bool
+	}{
+		{"replica1", "archiver", "replica1:3306", "shop", false},
+		{"replica2:3307", "archiver", "replica2:3307", "shop", false},
+		{"monitor:pw@tcp(replica3:3306)/", "monitor", "replica3:3306", "", false},
+		{"", "", "", "", true},
+		{"monitor@tcp(replica3", "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseReplica(tt.value, source)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseReplica(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got.User != tt.wantUser || got.Addr != tt.wantAddr || got.DBName != tt.wantDb {
+				t.Errorf("parseReplica(%q) = %s@%s/%s, want %s@%s/%s", tt.value, got.User, got.Addr, got.DBName, tt.wantUser, tt.wantAddr, tt.wantDb)
+			}
+			if got.Params["time_zone"] != "'+00:00'" {
+				t.Errorf("parseReplica(%q) time_zone = %q", tt.value, got.Params["time_zone"])
+			}
+		})
+	}
+	if source.Addr != "primary:3306" || source.Params["time_zone"] != "" {
+		t.Errorf("source config changed to %s with %v", source.Addr, source.Params)
+	}
+}
+
+func TestQuoteMySQLTable(t *testing.T) {
+	for table, want := range map[string]string{
+		"heartbeat":         "`heartbeat`",
+		"percona.heartbeat": "`percona`.`heartbeat`",
+	} {
+		if got := quoteMySQLTable(table); got != want {
+			t.Errorf("quoteMySQLTable(%q) = %s, want %s", table, got, want)
+		}
+	}
+}
+
+func TestThrottlerWait(t *testing.T) {
+	var throttler *Throttler
+	if err := throttler.Wait(func() bool { return false }); err != nil {
+		t.Errorf("nil throttler: %v", err)
+	}
+
+	// Without thresholds nothing is checked, the source is not even queried
+	throttler = NewThrottler(nil, nil, ThrottleOptions{Interval: time.Hour})
+	if err := throttler.Wait(func() bool { return false }); err != nil {
+		t.Errorf("no thresholds: %v", err)
+	}
+
+	// Stopped copies do not wait at all
+	throttler = NewThrottler(nil, nil, ThrottleOptions{MaxThreadsRunning: 1, Interval: time.Hour})
+	if err := throttler.Wait(func() bool { return true }); err != nil {
+		t.Errorf("stopped: %v", err)
+	}
+}
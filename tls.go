@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// TLS modes of MySQL connections
+const (
+	// TLSDisabled connects without TLS
+	TLSDisabled = "disabled"
+	// TLSPreferred uses TLS without verifying the server certificate when the server supports it
+	TLSPreferred = "preferred"
+	// TLSRequired fails unless the server certificate is verified against the CA bundle or system roots
+	TLSRequired = "required"
+	// TLSSkipVerify fails without TLS but accepts any server certificate
+	TLSSkipVerify = "skip-verify"
+)
+
+var tlsModes = []string{TLSDisabled, TLSPreferred, TLSRequired, TLSSkipVerify}
+
+// tlsConfigName is the name the TLS config is registered with the MySQL driver under.
+const tlsConfigName = "arklite"
+
+type TLSOptions struct {
+	Mode string
+	// CA is a PEM bundle of certificates to verify the server certificate with instead of system roots
+	CA string
+	// Cert and Key are PEM files of the client certificate, for servers requiring X509
+	Cert string
+	Key  string
+	// ServerName is the host name the server certificate must be issued for, the host connected to when empty
+	ServerName string
+}
+
+// Check picks required mode when certificates are given without a mode and validates the options.
+func (o *TLSOptions) Check() error {
+	files := o.CA != "" || o.Cert != "" || o.Key != "" || o.ServerName != ""
+	if o.Mode == "" {
+		o.Mode = TLSDisabled
+		if files {
+			o.Mode = TLSRequired
+		}
+	}
+	if !slices.Contains(tlsModes, o.Mode) {
+		return fmt.Errorf("unknown TLS mode %q, expected one of %s", o.Mode, strings.Join(tlsModes, ", "))
+	}
+	if o.Mode == TLSDisabled && files {
+		return errors.New("TLS certificates and server name can not be used with disabled TLS")
+	}
+	if (o.Cert == "") != (o.Key == "") {
+		return errors.New("client certificate and key need each other")
+	}
+	return nil
+}
+
+// Apply registers TLS config with the MySQL driver and makes the connection use it.
+func (o TLSOptions) Apply(config *mysql.Config) error {
+	if o.Mode == TLSDisabled || o.Mode == "" {
+		return nil
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.Mode != TLSRequired,
+	}
+	if o.CA != "" {
+		pem, err := os.ReadFile(o.CA)
+		if err != nil {
+			return err
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", o.CA)
+		}
+	}
+	if o.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(o.Cert, o.Key)
+		if err != nil {
+			return err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if err := mysql.RegisterTLSConfig(tlsConfigName, tlsConfig); err != nil {
+		return err
+	}
+	config.TLSConfig = tlsConfigName
+	config.AllowFallbackToPlaintext = o.Mode == TLSPreferred
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// writeSelfSigned writes a self-signed certificate for localhost and its key into dir.
+func writeSelfSigned(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestTLSOptionsCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     TLSOptions
+		wantMode string
+		wantErr  bool
+	}{
+		{"default", TLSOptions{}, TLSDisabled, false},
+		{"ca implies required", TLSOptions{CA: "ca.pem"}, TLSRequired, false},
+		{"client cert implies required", TLSOptions{Cert: "cert.pem", Key: "key.pem"}, TLSRequired, false},
+		{"preferred with ca", TLSOptions{Mode: TLSPreferred, CA: "ca.pem"}, TLSPreferred, false},
+		{"skip verify", TLSOptions{Mode: TLSSkipVerify}, TLSSkipVerify, false},
+		{"unknown mode", TLSOptions{Mode: "verify-full"}, "", true},
+		{"disabled with ca", TLSOptions{Mode: TLSDisabled, CA: "ca.pem"}, "", true},
+		{"cert without key", TLSOptions{Cert: "cert.pem"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Check()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.opts.Mode != tt.wantMode {
+				t.Errorf("mode = %s, want %s", tt.opts.Mode, tt.wantMode)
+			}
+		})
+	}
+}
+
+func TestTLSOptionsApply(t *testing.T) {
+	certFile, keyFile := writeSelfSigned(t, t.TempDir())
+
+	config := &mysql.Config{User: "root", Net: "tcp", Addr: "localhost:3306"}
+	opts := TLSOptions{Mode: TLSRequired, CA: certFile, Cert: certFile, Key: keyFile}
+	if err := opts.Apply(config); err != nil {
+		t.Fatal(err)
+	}
+	// The DSN refers to the registered config, which the driver resolves when parsing it
+	parsed, err := mysql.ParseDSN(config.FormatDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.TLS == nil || parsed.TLS.RootCAs == nil || len(parsed.TLS.Certificates) != 1 {
+		t.Fatalf("TLS config = %+v", parsed.TLS)
+	}
+	if parsed.TLS.InsecureSkipVerify || parsed.AllowFallbackToPlaintext {
+		t.Error("required TLS skips verification or falls back to plain text")
+	}
+	if parsed.TLS.ServerName != "localhost" {
+		t.Errorf("server name = %q, want localhost", parsed.TLS.ServerName)
+	}
+
+	replica, err := parseReplica("monitor@tcp(replica1:3306)/", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replica.TLSConfig != tlsConfigName {
+		t.Errorf("replica TLS config = %q, want %s", replica.TLSConfig, tlsConfigName)
+	}
+
+	config = &mysql.Config{User: "root", Net: "tcp", Addr: "localhost:3306"}
+	if err := (TLSOptions{Mode: TLSPreferred}).Apply(config); err != nil {
+		t.Fatal(err)
+	}
+	if !config.AllowFallbackToPlaintext {
+		t.Error("preferred TLS does not fall back to plain text")
+	}
+
+	if err := (TLSOptions{Mode: TLSRequired, CA: keyFile}).Apply(config); err == nil {
+		t.Error("CA bundle without certificates, want error")
+	}
+}
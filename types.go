@@ -0,0 +1,417 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Storage formats of DECIMAL columns
+const (
+	DecimalText    = "text"
+	DecimalInteger = "integer"
+	DecimalReal    = "real"
+)
+
+var decimalFormats = []string{DecimalText, DecimalInteger, DecimalReal}
+
+// Storage formats of BIGINT UNSIGNED columns
+const (
+	UnsignedInteger = "integer"
+	UnsignedText    = "text"
+	UnsignedBlob    = "blob"
+)
+
+var unsignedFormats = []string{UnsignedInteger, UnsignedText, UnsignedBlob}
+
+// Storage formats of DATE, DATETIME and TIMESTAMP columns
+const (
+	DatetimeISO    = "iso"
+	DatetimeUnix   = "unix"
+	DatetimeJulian = "julian"
+)
+
+var datetimeFormats = []string{DatetimeISO, DatetimeUnix, DatetimeJulian}
+
+// Ways to store zero dates like 0000-00-00, which are not valid dates anywhere but in MySQL
+const (
+	ZeroDateNull  = "null"
+	ZeroDateKeep  = "keep"
+	ZeroDateError = "error"
+)
+
+var zeroDateModes = []string{ZeroDateNull, ZeroDateKeep, ZeroDateError}
+
+// TypeMapping holds storage formats chosen for MySQL types which can be
+// stored in SQLite in more than one way.
+type TypeMapping struct {
+	Decimal  ColumnFormats
+	Unsigned ColumnFormats
+	Datetime ColumnFormats
+	ZeroDate string
+	// DatetimeZone is the time zone DATETIME values are in, they are converted
+	// to UTC unless it is nil. TIMESTAMP values are always read in UTC.
+	DatetimeZone *time.Location
+}
+
+// ColumnFormats is a storage format for columns of some type with per column overrides.
+type ColumnFormats struct {
+	Default string
+	// Columns are keyed by "column" or "table.column"
+	Columns map[string]string
+}
+
+// parseColumnFormats parses values in form of "format", "column=format" or "table.column=format".
+func parseColumnFormats(values []string, allowed []string, defaultFormat string) (ColumnFormats, error) {
+	formats := ColumnFormats{Default: defaultFormat, Columns: map[string]string{}}
+	for _, value := range values {
+		column, format, found := strings.Cut(value, "=")
+		if !found {
+			column, format = "", column
+		}
+		column = strings.TrimSpace(column)
+		format = strings.ToLower(strings.TrimSpace(format))
+		if !slices.Contains(allowed, format) {
+			return formats, fmt.Errorf("unknown format %q in %q, expected one of %s", format, value, strings.Join(allowed, ", "))
+		}
+		if !found {
+			formats.Default = format
+			continue
+		}
+		if column == "" {
+			return formats, fmt.Errorf("empty column in %q", value)
+		}
+		formats.Columns[column] = format
+	}
+	return formats, nil
+}
+
+func (f ColumnFormats) For(table, column string) string {
+	if format, ok := f.Columns[table+"."+column]; ok {
+		return format
+	}
+	if format, ok := f.Columns[column]; ok {
+		return format
+	}
+	return f.Default
+}
+
+// applyTypeMapping picks storage formats for columns of a table and
+// checks they can hold the column values.
+func applyTypeMapping(table string, columns []*ColumnInfo, mapping TypeMapping) error {
+	for _, column := range columns {
+		if column.unsigned64() {
+			column.format = mapping.Unsigned.For(table, column.name)
+			// Nullable columns are scanned as sql.NullInt64 which can not hold values above 2^63-1
+			if column.reflectType == reflect.TypeOf(sql.NullInt64{}) {
+				column.reflectType = reflect.TypeOf(sql.Null[uint64]{})
+			}
+		}
+		if column.temporal() {
+			column.format = mapping.Datetime.For(table, column.name)
+			column.zeroDate = mapping.ZeroDate
+			if column.dataType == "datetime" {
+				column.location = mapping.DatetimeZone
+			}
+			// Values are read as text to see zero dates, the driver can not parse them
+			column.reflectType = reflect.TypeOf(sql.NullString{})
+		}
+		if column.dataType == "decimal" {
+			column.format = mapping.Decimal.For(table, column.name)
+			if column.format == DecimalInteger && column.precision > 18 {
+				return fmt.Errorf(
+					"column %s %s does not fit into 64-bit INTEGER when scaled, store it as %s",
+					column.name, column.columnType, DecimalText,
+				)
+			}
+		}
+		column.sqliteType = sqliteType(column.mysqlType, column.format)
+	}
+	return nil
+}
+
+func (c *ColumnInfo) unsigned64() bool {
+	return c.dataType == "bigint" && strings.Contains(strings.ToLower(c.columnType), "unsigned")
+}
+
+func (c *ColumnInfo) temporal() bool {
+	return c.dataType == "date" || c.dataType == "datetime" || c.dataType == "timestamp"
+}
+
+func (c *ColumnInfo) integer() bool {
+	return slices.Contains([]string{"tinyint", "smallint", "mediumint", "int", "integer", "bigint"}, c.dataType)
+}
+
+// sqliteValue converts a scanned MySQL value into the format the column is stored in.
+func (c *ColumnInfo) sqliteValue(scanned any) (any, error) {
+	converted := c.temporal() || c.unsigned64() || c.dataType == "decimal" && c.format == DecimalInteger
+	if c.format == "" || !converted {
+		return scanned, nil
+	}
+
+	value, err := scannedValue(scanned)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	switch {
+	case c.temporal():
+		switch v := value.(type) {
+		case string:
+			return c.temporalValue(v)
+		case []byte:
+			return c.temporalValue(string(v))
+		case time.Time:
+			// Cursors of checkpoints made before values were read as text
+			if c.dataType == "date" {
+				return c.temporalValue(v.Format(time.DateOnly))
+			}
+			return c.temporalValue(v.Format("2006-01-02 15:04:05.999999"))
+		default:
+			return nil, fmt.Errorf("unexpected %s value of type %T in column %s", strings.ToUpper(c.dataType), value, c.name)
+		}
+
+	case c.dataType == "decimal":
+		switch v := value.(type) {
+		case string:
+			return scaleDecimal(v, c.scale)
+		case []byte:
+			return scaleDecimal(string(v), c.scale)
+		default:
+			return nil, fmt.Errorf("unexpected DECIMAL value of type %T in column %s", value, c.name)
+		}
+
+	default:
+		var unsigned uint64
+		switch v := value.(type) {
+		case uint64:
+			unsigned = v
+		case int64:
+			unsigned = uint64(v)
+		default:
+			return nil, fmt.Errorf("unexpected BIGINT UNSIGNED value of type %T in column %s", value, c.name)
+		}
+		return unsignedValue(unsigned, c.format, c.name)
+	}
+}
+
+// temporalValue converts DATE, DATETIME or TIMESTAMP value as MySQL prints it,
+// like "2025-01-02 03:04:05.123456", into the format the column is stored in.
+func (c *ColumnInfo) temporalValue(value string) (any, error) {
+	if zeroDate(value) {
+		switch c.zeroDate {
+		case ZeroDateKeep:
+			return value, nil
+		case ZeroDateError:
+			return nil, fmt.Errorf("zero date %s in column %s", value, c.name)
+		default:
+			return nil, nil
+		}
+	}
+
+	if c.format == DatetimeISO && c.location == nil {
+		// Already in ISO-8601 as SQLite date and time functions expect it
+		return value, nil
+	}
+
+	location := c.location
+	if location == nil {
+		location = time.UTC
+	}
+	t, err := time.ParseInLocation(time.DateTime, value, location)
+	if c.dataType == "date" {
+		t, err = time.ParseInLocation(time.DateOnly, value, location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad %s value in column %s: %w", strings.ToUpper(c.dataType), c.name, err)
+	}
+	t = t.UTC()
+
+	switch c.format {
+	case DatetimeUnix:
+		if c.precision == 0 {
+			return t.Unix(), nil
+		}
+		return float64(t.UnixMicro()) / 1e6, nil
+	case DatetimeJulian:
+		// Julian day of the Unix epoch
+		return float64(t.UnixMicro())/1e6/86400 + 2440587.5, nil
+	default:
+		if c.precision == 0 {
+			return t.Format(time.DateTime), nil
+		}
+		return t.Format(time.DateTime + "." + strings.Repeat("0", c.precision)), nil
+	}
+}
+
+// mysqlValue converts a value read from SQLite back into what the MySQL column
+// accepts, inverse to sqliteValue.
+func (c *ColumnInfo) mysqlValue(value any) (any, error) {
+	if value == nil || c.format == "" {
+		return value, nil
+	}
+
+	switch {
+	case c.temporal():
+		return c.mysqlTemporalValue(value)
+
+	case c.dataType == "decimal" && c.format == DecimalInteger:
+		scaled, ok := value.(int64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected scaled DECIMAL value of type %T in column %s", value, c.name)
+		}
+		return unscaleDecimal(scaled, c.scale), nil
+
+	case c.unsigned64() && c.format == UnsignedText:
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected BIGINT UNSIGNED text value of type %T in column %s", value, c.name)
+		}
+		unsigned, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad BIGINT UNSIGNED value in column %s: %w", c.name, err)
+		}
+		return strconv.FormatUint(unsigned, 10), nil
+
+	case c.unsigned64() && c.format == UnsignedBlob:
+		blob, ok := value.([]byte)
+		if !ok || len(blob) != 8 {
+			return nil, fmt.Errorf("unexpected BIGINT UNSIGNED blob value %v in column %s", value, c.name)
+		}
+		return strconv.FormatUint(binary.BigEndian.Uint64(blob), 10), nil
+	}
+	return value, nil
+}
+
+// mysqlTemporalValue turns stored DATE, DATETIME or TIMESTAMP value back into text MySQL accepts.
+func (c *ColumnInfo) mysqlTemporalValue(value any) (any, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case string:
+		if zeroDate(v) || c.format == DatetimeISO && c.location == nil {
+			return v, nil
+		}
+		var err error
+		t, err = time.ParseInLocation(time.DateTime, v, time.UTC)
+		if c.dataType == "date" {
+			t, err = time.ParseInLocation(time.DateOnly, v, time.UTC)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bad %s value in column %s: %w", strings.ToUpper(c.dataType), c.name, err)
+		}
+	case int64:
+		t = time.Unix(v, 0)
+		if c.format == DatetimeJulian {
+			t = julianTime(float64(v))
+		}
+	case float64:
+		t = time.UnixMicro(int64(math.Round(v * 1e6)))
+		if c.format == DatetimeJulian {
+			t = julianTime(v)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected %s value of type %T in column %s", strings.ToUpper(c.dataType), value, c.name)
+	}
+
+	// Dates are never converted between time zones
+	if c.location != nil && c.dataType != "date" {
+		t = t.In(c.location)
+	} else {
+		t = t.UTC()
+	}
+	if c.dataType == "date" {
+		return t.Format(time.DateOnly), nil
+	}
+	if c.precision == 0 {
+		return t.Format(time.DateTime), nil
+	}
+	return t.Format(time.DateTime + "." + strings.Repeat("0", c.precision)), nil
+}
+
+func julianTime(day float64) time.Time {
+	return time.UnixMicro(int64(math.Round((day - 2440587.5) * 86400 * 1e6)))
+}
+
+// zeroDate tells if MySQL date has zero year, month or day, e.g. 0000-00-00 or 2025-00-00.
+func zeroDate(value string) bool {
+	return len(value) >= 10 && (value[:4] == "0000" || value[5:7] == "00" || value[8:10] == "00")
+}
+
+// scannedValue dereferences a value scanned into a pointer and unwraps nullable types.
+// NULL of binary columns is scanned as nil []byte, empty values are not nil.
+func scannedValue(scanned any) (any, error) {
+	value := reflect.ValueOf(scanned).Elem().Interface()
+	if bytes, ok := value.([]byte); ok && bytes == nil {
+		return nil, nil
+	}
+	// Value() of sql.Null[uint64] refuses values above 2^63-1
+	if unsigned, ok := value.(sql.Null[uint64]); ok {
+		if !unsigned.Valid {
+			return nil, nil
+		}
+		return unsigned.V, nil
+	}
+	if valuer, ok := value.(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	return value, nil
+}
+
+// unsignedValue stores unsigned 64-bit integer in the given format. Text is zero
+// padded and blob is big-endian, so both sort the same way as the numbers do.
+func unsignedValue(v uint64, format string, column string) (any, error) {
+	switch format {
+	case UnsignedText:
+		return fmt.Sprintf("%020d", v), nil
+	case UnsignedBlob:
+		return binary.BigEndian.AppendUint64(nil, v), nil
+	default:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf(
+				"value %d of column %s does not fit into SQLite INTEGER, store it as %s or %s with --unsigned",
+				v, column, UnsignedText, UnsignedBlob,
+			)
+		}
+		return int64(v), nil
+	}
+}
+
+// unscaleDecimal turns integer of the smallest units back into decimal string, e.g. -1230 with scale 2 into "-12.30".
+func unscaleDecimal(scaled int64, scale int) string {
+	digits := strconv.FormatUint(uint64(scaled), 10)
+	sign := ""
+	if scaled < 0 {
+		digits = strconv.FormatUint(uint64(-scaled), 10)
+		sign = "-"
+	}
+	if scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= scale {
+		digits = strings.Repeat("0", scale-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-scale] + "." + digits[len(digits)-scale:]
+}
+
+// scaleDecimal turns decimal string into an integer of its smallest units, e.g. "-12.3" with scale 2 into -1230.
+func scaleDecimal(value string, scale int) (int64, error) {
+	whole, fraction, _ := strings.Cut(value, ".")
+	if len(fraction) > scale {
+		return 0, fmt.Errorf("decimal %s has more than %d digits after the point", value, scale)
+	}
+	scaled, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", scale-len(fraction)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("decimal %s can not be scaled: %w", value, err)
+	}
+	return scaled, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"database/sql"
+	"maps"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScaleDecimal(t *testing.T) {
+	tests := []struct {
+		value   string
+		scale   int
+		want    int64
+		wantErr bool
+	}{
+		{"12.34", 2, 1234, false},
+		{"-12.30", 2, -1230, false},
+		{"-0.05", 2, -5, false},
+		{"7", 0, 7, false},
+		{"7.5", 3, 7500, false},
+		{"99999999999999.9999", 4, 999999999999999999, false},
+		{"1.234", 2, 0, true},
+		{"99999999999999999999", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := scaleDecimal(tt.value, tt.scale)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("scaleDecimal(%q, %d) error = %v, wantErr %v", tt.value, tt.scale, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("scaleDecimal(%q, %d) = %d, want %d", tt.value, tt.scale, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseColumnFormats(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      []string
+		wantDefault string
+		wantColumns map[string]string
+		wantErr     bool
+	}{
+		{"defaults", nil, DecimalText, map[string]string{}, false},
+		{"default override", []string{"real"}, DecimalReal, map[string]string{}, false},
+		{
+			"columns", []string{"amount=integer", "orders.total = REAL"}, DecimalText,
+			map[string]string{"amount": DecimalInteger, "orders.total": DecimalReal}, false,
+		},
+		{"unknown format", []string{"amount=float"}, "", nil, true},
+		{"empty column", []string{"=integer"}, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseColumnFormats(tt.values, decimalFormats, DecimalText)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseColumnFormats() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Default != tt.wantDefault || !maps.Equal(got.Columns, tt.wantColumns) {
+				t.Errorf("parseColumnFormats() = %+v, want default %q and columns %v", got, tt.wantDefault, tt.wantColumns)
+			}
+		})
+	}
+
+	formats := ColumnFormats{Default: DecimalText, Columns: map[string]string{"amount": DecimalReal, "orders.amount": DecimalInteger}}
+	if got := formats.For("orders", "amount"); got != DecimalInteger {
+		t.Errorf("For(orders, amount) = %q, want %q", got, DecimalInteger)
+	}
+	if got := formats.For("payments", "amount"); got != DecimalReal {
+		t.Errorf("For(payments, amount) = %q, want %q", got, DecimalReal)
+	}
+	if got := formats.For("payments", "fee"); got != DecimalText {
+		t.Errorf("For(payments, fee) = %q, want %q", got, DecimalText)
+	}
+}
+
+func TestUnsignedValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   uint64
+		format  string
+		want    any
+		wantErr bool
+	}{
+		{"integer", 42, UnsignedInteger, int64(42), false},
+		{"integer max", math.MaxInt64, UnsignedInteger, int64(math.MaxInt64), false},
+		{"integer overflow", math.MaxInt64 + 1, UnsignedInteger, nil, true},
+		{"text", 42, UnsignedText, "00000000000000000042", false},
+		{"text max", math.MaxUint64, UnsignedText, "18446744073709551615", false},
+		{"blob", math.MaxInt64 + 1, UnsignedBlob, []byte{0x80, 0, 0, 0, 0, 0, 0, 0}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unsignedValue(tt.value, tt.format, "id")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unsignedValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unsignedValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemporalValue(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	tests := []struct {
+		name    string
+		column  ColumnInfo
+		value   string
+		want    any
+		wantErr bool
+	}{
+		{"iso kept as is", ColumnInfo{dataType: "datetime", format: DatetimeISO}, "2025-01-02 03:04:05", "2025-01-02 03:04:05", false},
+		{"iso date", ColumnInfo{dataType: "date", format: DatetimeISO}, "2025-01-02", "2025-01-02", false},
+		{
+			"iso in time zone", ColumnInfo{dataType: "datetime", format: DatetimeISO, precision: 3, location: berlin},
+			"2025-07-01 12:00:00.250", "2025-07-01 10:00:00.250", false,
+		},
+		{"unix", ColumnInfo{dataType: "timestamp", format: DatetimeUnix}, "1970-01-02 00:00:00", int64(86400), false},
+		{"unix fraction", ColumnInfo{dataType: "datetime", format: DatetimeUnix, precision: 6}, "1970-01-01 00:00:01.500000", 1.5, false},
+		{"unix date", ColumnInfo{dataType: "date", format: DatetimeUnix}, "1970-01-03", int64(172800), false},
+		{"unix in time zone", ColumnInfo{dataType: "datetime", format: DatetimeUnix, location: berlin}, "1970-01-01 01:00:00", int64(0), false},
+		{"julian", ColumnInfo{dataType: "datetime", format: DatetimeJulian}, "2000-01-01 12:00:00", 2451545.0, false},
+		{"zero date as null", ColumnInfo{dataType: "datetime", format: DatetimeUnix, zeroDate: ZeroDateNull}, "0000-00-00 00:00:00", nil, false},
+		{"zero day kept", ColumnInfo{dataType: "date", format: DatetimeUnix, zeroDate: ZeroDateKeep}, "2025-01-00", "2025-01-00", false},
+		{"zero date error", ColumnInfo{dataType: "date", format: DatetimeISO, zeroDate: ZeroDateError}, "0000-00-00", nil, true},
+		{"malformed", ColumnInfo{dataType: "datetime", format: DatetimeUnix}, "yesterday", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.column.temporalValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("temporalValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("temporalValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScannedValue(t *testing.T) {
+	big := sql.Null[uint64]{V: math.MaxUint64, Valid: true}
+	if got, err := scannedValue(&big); err != nil || got != uint64(math.MaxUint64) {
+		t.Errorf("scannedValue(Null[uint64]) = %v, %v", got, err)
+	}
+	null := sql.Null[uint64]{}
+	if got, err := scannedValue(&null); err != nil || got != nil {
+		t.Errorf("scannedValue(NULL) = %v, %v", got, err)
+	}
+	str := sql.NullString{String: "x", Valid: true}
+	if got, err := scannedValue(&str); err != nil || got != "x" {
+		t.Errorf("scannedValue(NullString) = %v, %v", got, err)
+	}
+}
+
+func TestMySQLValue(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+
+	tests := []struct {
+		name    string
+		column  ColumnInfo
+		value   any
+		want    any
+		wantErr bool
+	}{
+		{"null", ColumnInfo{dataType: "datetime", format: DatetimeUnix}, nil, nil, false},
+		{"not converted", ColumnInfo{dataType: "varchar", format: ""}, "abc", "abc", false},
+		{"scaled decimal", ColumnInfo{dataType: "decimal", format: DecimalInteger, scale: 2}, int64(-1230), "-12.30", false},
+		{"scaled decimal below one", ColumnInfo{dataType: "decimal", format: DecimalInteger, scale: 3}, int64(5), "0.005", false},
+		{"decimal text", ColumnInfo{dataType: "decimal", format: DecimalText}, "12.30", "12.30", false},
+		{
+			"unsigned text", ColumnInfo{dataType: "bigint", columnType: "bigint unsigned", format: UnsignedText},
+			"18446744073709551615", "18446744073709551615", false,
+		},
+		{
+			"unsigned blob", ColumnInfo{dataType: "bigint", columnType: "bigint unsigned", format: UnsignedBlob},
+			[]byte{0, 0, 0, 0, 0, 0, 0, 42}, "42", false,
+		},
+		{"unix", ColumnInfo{dataType: "timestamp", format: DatetimeUnix}, int64(86400), "1970-01-02 00:00:00", false},
+		{"unix fraction", ColumnInfo{dataType: "datetime", format: DatetimeUnix, precision: 2}, 1.5, "1970-01-01 00:00:01.50", false},
+		{"unix date", ColumnInfo{dataType: "date", format: DatetimeUnix}, int64(172800), "1970-01-03", false},
+		{"unix in time zone", ColumnInfo{dataType: "datetime", format: DatetimeUnix, location: berlin}, int64(0), "1970-01-01 01:00:00", false},
+		{"julian", ColumnInfo{dataType: "datetime", format: DatetimeJulian}, 2451545.0, "2000-01-01 12:00:00", false},
+		{"iso kept as is", ColumnInfo{dataType: "datetime", format: DatetimeISO}, "2025-01-02 03:04:05", "2025-01-02 03:04:05", false},
+		{
+			"iso in time zone", ColumnInfo{dataType: "datetime", format: DatetimeISO, precision: 3, location: berlin},
+			"2025-07-01 10:00:00.250", "2025-07-01 12:00:00.250", false,
+		},
+		{"zero date kept", ColumnInfo{dataType: "date", format: DatetimeUnix}, "0000-00-00", "0000-00-00", false},
+		{"wrong type", ColumnInfo{dataType: "decimal", format: DecimalInteger}, "12", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.column.mysqlValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mysqlValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mysqlValue() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type VerifierOptions struct {
+	ChunkSize int
+	// After skips rows up to this cursor, e.g. those archived before an append
+	After Cursor
+	// UpTo stops at this cursor, e.g. the largest id archived by a copy with --limit
+	UpTo     Cursor
+	Progress ProgressRenderer
+}
+
+type Verifier struct {
+	mysqlDb  *sql.DB
+	sqliteDb *sql.DB
+	opts     VerifierOptions
+	schema   *Schema
+	// Rows are read with prepared statements like the copier does, from the beginning and after a cursor
+	first *sql.Stmt
+	next  *sql.Stmt
+}
+
+// VerifyMismatch is a key range (From, To] of rows read from MySQL which differ
+// from rows with the same ids in SQLite. Nil From means the range starts at
+// the beginning of the table.
+type VerifyMismatch struct {
+	From       Cursor
+	To         Cursor
+	MySQLRows  uint64
+	SQLiteRows uint64
+}
+
+func (m VerifyMismatch) String() string {
+	from := "..."
+	if m.From != nil {
+		from = m.From.String()
+	}
+	keyRange := fmt.Sprintf("ids (%s, %s]", from, m.To)
+	if m.To == nil {
+		keyRange = fmt.Sprintf("ids (%s, ...)", from)
+	}
+	if m.MySQLRows != m.SQLiteRows {
+		return fmt.Sprintf("%s: %d rows in MySQL, %d rows in SQLite", keyRange, m.MySQLRows, m.SQLiteRows)
+	}
+	return fmt.Sprintf("%s: %d rows, checksums differ", keyRange, m.MySQLRows)
+}
+
+type VerifyResult struct {
+	MySQLRows  uint64
+	SQLiteRows uint64
+	Chunks     uint64
+	Mismatches []VerifyMismatch
+	// UnmatchedSQLiteRows are rows of SQLite with ids not read from MySQL
+	UnmatchedSQLiteRows uint64
+}
+
+func (r *VerifyResult) Ok() bool {
+	return len(r.Mismatches) == 0 && r.MySQLRows == r.SQLiteRows
+}
+
+func NewVerifier(mysqlDb *sql.DB, sqliteDb *sql.DB, schema *Schema, opts VerifierOptions) *Verifier {
+	return &Verifier{
+		mysqlDb:  mysqlDb,
+		sqliteDb: sqliteDb,
+		schema:   schema,
+		opts:     opts,
+	}
+}
+
+// verifyChunk is a chunk of rows read from MySQL: SQLite values of their id columns
+// and the checksum of the rows as the copier writes them into SQLite.
+type verifyChunk struct {
+	keys [][]any
+	sum  []byte
+	last Cursor
+}
+
+// Verify compares rows in MySQL and SQLite chunk by chunk. Chunks are read from MySQL in order of id
+// columns and SQLite rows are fetched by the exact ids of each chunk, as SQLite may order ids differently,
+// e.g. strings MySQL compares with a case-insensitive collation. Checksums do not depend on the order of rows.
+func (v *Verifier) Verify() (*VerifyResult, error) {
+	slog.Info("Verifying SQLite data against MySQL", "table", v.schema.Table)
+
+	var err error
+	if v.first, err = v.mysqlDb.Prepare(v.mysqlQuery(false)); err != nil {
+		return nil, err
+	}
+	defer v.first.Close()
+	if v.next, err = v.mysqlDb.Prepare(v.mysqlQuery(true)); err != nil {
+		return nil, err
+	}
+	defer v.next.Close()
+
+	v.opts.Progress.RenderBlank()
+	defer v.opts.Progress.Finish()
+
+	result := &VerifyResult{}
+	cursor := v.opts.After
+	for {
+		chunkStartAt := time.Now()
+
+		chunk, err := v.readMySQLChunk(cursor)
+		if err != nil {
+			return nil, err
+		}
+		mysqlRows := uint64(len(chunk.keys))
+		sqliteSum, sqliteRows, err := v.checksumSQLiteRows(chunk.keys)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Chunks++
+		result.MySQLRows += mysqlRows
+		result.SQLiteRows += sqliteRows
+		if mysqlRows != sqliteRows || !bytes.Equal(chunk.sum, sqliteSum) {
+			mismatch := VerifyMismatch{
+				From:       cursor,
+				To:         chunk.last,
+				MySQLRows:  mysqlRows,
+				SQLiteRows: sqliteRows,
+			}
+			slog.Debug("Chunk mismatch", "mismatch", mismatch.String())
+			result.Mismatches = append(result.Mismatches, mismatch)
+		}
+
+		slog.Debug(
+			"Chunk verified",
+			"chunk_duration", time.Since(chunkStartAt),
+			"after_id", cursor,
+			"last_id", chunk.last,
+			"mysql_rows", mysqlRows,
+			"sqlite_rows", sqliteRows,
+		)
+
+		if err := v.opts.Progress.Add64(int64(mysqlRows)); err != nil {
+			return nil, err
+		}
+
+		if mysqlRows < uint64(v.opts.ChunkSize) {
+			break
+		}
+		cursor = chunk.last
+	}
+
+	// Rows missing from MySQL are never asked for by ids, count them instead. Bounds of a range
+	// can not be applied to ids SQLite sorts differently, those outside of it would be counted.
+	if (v.opts.After != nil || v.opts.UpTo != nil) && !v.schema.SQLiteOrdersLikeMySQL() {
+		slog.Warn("Ids sort differently in SQLite, rows of the range missing from MySQL are not looked for", "table", v.schema.Table)
+		return result, nil
+	}
+	total, err := v.countSQLiteRows()
+	if err != nil {
+		return nil, err
+	}
+	if total > result.SQLiteRows {
+		result.UnmatchedSQLiteRows = total - result.SQLiteRows
+		result.SQLiteRows = total
+	}
+	return result, nil
+}
+
+func (v *Verifier) mysqlQuery(afterCursor bool) string {
+	if v.opts.UpTo != nil {
+		return v.schema.MySQLSelectUpToQuery(int64(v.opts.ChunkSize), afterCursor)
+	}
+	return v.schema.MySQLSelectQuery(int64(v.opts.ChunkSize), afterCursor)
+}
+
+// readMySQLChunk reads up to ChunkSize rows after cursor from MySQL.
+func (v *Verifier) readMySQLChunk(cursor Cursor) (*verifyChunk, error) {
+	stmt := v.first
+	if cursor != nil {
+		stmt = v.next
+	}
+	rows, err := stmt.Query(append(keysetArgs(cursor), keysetArgs(v.opts.UpTo)...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chunk := &verifyChunk{}
+	var digests [][]byte
+	var lastRow RowData
+	idIndexes := v.schema.IdColumnIndexes()
+	for rows.Next() {
+		row := v.schema.NewRow()
+		if err := rows.Scan(row...); err != nil {
+			return nil, err
+		}
+		values, err := v.schema.SqliteValues(row)
+		if err != nil {
+			return nil, err
+		}
+		for i, column := range v.schema.Columns {
+			if values[i], err = storedValue(values[i], column.sqliteType); err != nil {
+				return nil, fmt.Errorf("column %s: %w", column.name, err)
+			}
+		}
+		digest, err := rowDigest(values)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+		key := make([]any, len(idIndexes))
+		for i, index := range idIndexes {
+			key[i] = values[index]
+		}
+		chunk.keys = append(chunk.keys, key)
+		lastRow = row
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	chunk.sum = checksumDigests(digests)
+	if lastRow != nil {
+		if chunk.last, err = v.schema.RowCursor(lastRow); err != nil {
+			return nil, err
+		}
+	}
+	return chunk, nil
+}
+
+// sqliteMaxVariables is the limit of parameters of a single SQLite statement.
+const sqliteMaxVariables = 32766
+
+// checksumSQLiteRows reads rows with the given ids from SQLite.
+func (v *Verifier) checksumSQLiteRows(keys [][]any) ([]byte, uint64, error) {
+	var digests [][]byte
+	for batch := range slices.Chunk(keys, sqliteMaxVariables/len(v.schema.IdColumns)) {
+		args := make([]any, 0, len(batch)*len(v.schema.IdColumns))
+		for _, key := range batch {
+			args = append(args, key...)
+		}
+		batchDigests, err := readDigests(v.sqliteDb.Query(v.schema.SQLiteSelectIdsQuery(len(batch)), args...))
+		if err != nil {
+			return nil, 0, err
+		}
+		digests = append(digests, batchDigests...)
+	}
+	return checksumDigests(digests), uint64(len(digests)), nil
+}
+
+// countSQLiteRows counts rows of SQLite between After and UpTo.
+func (v *Verifier) countSQLiteRows() (uint64, error) {
+	var args []any
+	for _, cursor := range []Cursor{v.opts.After, v.opts.UpTo} {
+		key, err := v.schema.SqliteKey(cursor)
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, keysetArgs(key)...)
+	}
+	var count uint64
+	query := v.schema.SQLiteCountRangeQuery(v.opts.After != nil, v.opts.UpTo != nil)
+	err := v.sqliteDb.QueryRow(query, args...).Scan(&count)
+	return count, err
+}
+
+// storedValue is the value SQLite returns for value written into a column of the given type, one of
+// those returned by sqliteType, as database/sql converts it and SQLite applies the column affinity to it.
+func storedValue(value any, columnType string) (any, error) {
+	value, err := driver.DefaultParameterConverter.ConvertValue(value)
+	if err != nil {
+		return nil, err
+	}
+	switch v := value.(type) {
+	case []byte:
+		// Blobs are never converted, nil one is bound as NULL
+		if v == nil {
+			return nil, nil
+		}
+		return v, nil
+	case bool:
+		value = int64(0)
+		if v {
+			value = int64(1)
+		}
+	case string:
+		if columnType == "INTEGER" || columnType == "REAL" {
+			if number, ok := numericText(v); ok {
+				value = number
+			}
+		}
+	}
+
+	switch columnType {
+	case "TEXT":
+		switch v := value.(type) {
+		case int64:
+			return strconv.FormatInt(v, 10), nil
+		case float64:
+			return sqliteRealText(v), nil
+		}
+	case "INTEGER":
+		// Reals which are integers are stored as integers, unless at the very limits of int64
+		if v, ok := value.(float64); ok && v == math.Trunc(v) && v > math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), nil
+		}
+	case "REAL":
+		if v, ok := value.(int64); ok {
+			return float64(v), nil
+		}
+	}
+	return value, nil
+}
+
+var numericTextPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// numericText converts text looking like a number into integer or real, like SQLite does for numeric columns.
+func numericText(text string) (any, bool) {
+	text = strings.Trim(text, " \t\n\v\f\r")
+	if !numericTextPattern.MatchString(text) {
+		return nil, false
+	}
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return i, true
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return nil, false
+	}
+	return f, true
+}
+
+// sqliteRealText formats real as SQLite does when it is stored as text: 15 significant digits, always with a point.
+func sqliteRealText(v float64) string {
+	text := strconv.FormatFloat(v, 'g', 15, 64)
+	mantissa, exponent, found := strings.Cut(text, "e")
+	if !strings.Contains(mantissa, ".") && !math.IsInf(v, 0) {
+		mantissa += ".0"
+	}
+	if found {
+		return mantissa + "e" + exponent
+	}
+	return mantissa
+}
+
+// rowDigest hashes values of a row.
+func rowDigest(values []any) ([]byte, error) {
+	h := sha256.New()
+	for _, value := range values {
+		if err := hashValue(h, value); err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// checksumDigests combines digests of rows regardless of their order.
+func checksumDigests(digests [][]byte) []byte {
+	slices.SortFunc(digests, bytes.Compare)
+	h := sha256.New()
+	for _, digest := range digests {
+		h.Write(digest)
+	}
+	return h.Sum(nil)
+}
+
+func readDigests(rows *sql.Rows, err error) ([][]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	var digests [][]byte
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		digest, err := rowDigest(values)
+		if err != nil {
+			return nil, err
+		}
+		digests = append(digests, digest)
+	}
+	return digests, rows.Err()
+}
+
+func hashValue(h hash.Hash, value any) error {
+	var buf [8]byte
+	switch v := value.(type) {
+	case nil:
+		h.Write([]byte{'n'})
+	case int64:
+		binary.BigEndian.PutUint64(buf[:], uint64(v))
+		h.Write([]byte{'i'})
+		h.Write(buf[:])
+	case float64:
+		binary.BigEndian.PutUint64(buf[:], math.Float64bits(v))
+		h.Write([]byte{'f'})
+		h.Write(buf[:])
+	case string:
+		binary.BigEndian.PutUint64(buf[:], uint64(len(v)))
+		h.Write([]byte{'s'})
+		h.Write(buf[:])
+		h.Write([]byte(v))
+	case []byte:
+		binary.BigEndian.PutUint64(buf[:], uint64(len(v)))
+		h.Write([]byte{'b'})
+		h.Write(buf[:])
+		h.Write(v)
+	case bool:
+		h.Write([]byte{'t'})
+		if v {
+			h.Write([]byte{1})
+		} else {
+			h.Write([]byte{0})
+		}
+	case time.Time:
+		h.Write([]byte{'d'})
+		h.Write([]byte(v.UTC().Format(time.RFC3339Nano)))
+	default:
+		return fmt.Errorf("unexpected SQLite value type: %T", value)
+	}
+	return nil
+}
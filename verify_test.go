@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestChecksumDigests(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+CREATE TABLE a (id INTEGER, value);
+CREATE TABLE b (id INTEGER, value);
+INSERT INTO a VALUES (1, 'one'), (2, 2.5), (3, NULL), (4, x'00ff');
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		rowsB    string
+		wantSame bool
+	}{
+		{"same rows", "INSERT INTO b VALUES (1, 'one'), (2, 2.5), (3, NULL), (4, x'00ff')", true},
+		{"same rows in another order", "INSERT INTO b VALUES (4, x'00ff'), (2, 2.5), (1, 'one'), (3, NULL)", true},
+		{"changed text", "INSERT INTO b VALUES (1, 'two'), (2, 2.5), (3, NULL), (4, x'00ff')", false},
+		{"text instead of blob", "INSERT INTO b VALUES (1, 'one'), (2, 2.5), (3, NULL), (4, '00ff')", false},
+		{"integer instead of real", "INSERT INTO b VALUES (1, 'one'), (2, 2), (3, NULL), (4, x'00ff')", false},
+		{"empty string instead of null", "INSERT INTO b VALUES (1, 'one'), (2, 2.5), (3, ''), (4, x'00ff')", false},
+		{"missing row", "INSERT INTO b VALUES (1, 'one'), (2, 2.5), (4, x'00ff')", false},
+	}
+
+	digests, err := readDigests(db.Query("SELECT id, value FROM a ORDER BY id"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 4 {
+		t.Fatalf("readDigests() count = %d, want 4", len(digests))
+	}
+	wantSum := checksumDigests(digests)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := db.Exec("DELETE FROM b"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := db.Exec(tt.rowsB); err != nil {
+				t.Fatal(err)
+			}
+			digests, err := readDigests(db.Query("SELECT id, value FROM b"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if same := bytes.Equal(checksumDigests(digests), wantSum); same != tt.wantSame {
+				t.Errorf("checksums equal = %v, want %v", same, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestStoredValue(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`CREATE TABLE t ("TEXT" TEXT, "INTEGER" INTEGER, "REAL" REAL, "BLOB" BLOB)`); err != nil {
+		t.Fatal(err)
+	}
+	rawBytes := sql.RawBytes("12.50")
+	count := int32(7)
+	values := []any{
+		nil, int64(42), int64(-1), 2.5, 3.0, 1e20, 0.1, float64(1 << 52), float64(1 << 63), -0.0, "", "text", "12", " 12.50 ", "1e3", "12.0", "99999999999999999999", "-.5e-3", "0x10", "12abc", "Inf",
+		[]byte{}, []byte(nil), []byte("12"), true, &rawBytes, &count, (*int64)(nil), uint32(5), float32(0.1),
+	}
+	for _, columnType := range []string{"TEXT", "INTEGER", "REAL", "BLOB"} {
+		for _, value := range values {
+			if _, err := db.Exec("DELETE FROM t"); err != nil {
+				t.Fatal(err)
+			}
+			query := fmt.Sprintf(`INSERT INTO t (%q) VALUES (?)`, columnType)
+			if _, err := db.Exec(query, value); err != nil {
+				t.Fatal(err)
+			}
+			var stored any
+			if err := db.QueryRow(fmt.Sprintf(`SELECT %q FROM t`, columnType)).Scan(&stored); err != nil {
+				t.Fatal(err)
+			}
+			got, err := storedValue(value, columnType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, stored) {
+				t.Errorf("storedValue(%#v, %s) = %#v, SQLite stored %#v", value, columnType, got, stored)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Output formats
+const (
+	FormatSQLite  = "sqlite"
+	FormatParquet = "parquet"
+	FormatCSV     = "csv"
+	FormatJSONL   = "jsonl"
+)
+
+var outputFormats = []string{FormatSQLite, FormatParquet, FormatCSV, FormatJSONL}
+
+// FileOptions configure writers of formats other than SQLite, which write a plain file per table.
+type FileOptions struct {
+	Format string
+	// Compression is one of the codecs of the format, the first one of them when empty
+	Compression string
+	// BatchSize is --write-batch, Parquet makes a row group of every batch
+	BatchSize int
+	// Null is how CSV writes NULL values and Binary is BinaryBase64 or BinaryHex
+	Null   string
+	Binary string
+}
+
+// Check picks the default compression of the format or makes sure the chosen one is supported.
+func (o *FileOptions) Check() error {
+	compressions := textCompressions
+	if o.Format == FormatParquet {
+		compressions = parquetCompressions
+	}
+	if o.Compression == "" {
+		o.Compression = compressions[0]
+	}
+	if !slices.Contains(compressions, o.Compression) {
+		return fmt.Errorf("%s does not support %s compression, expected one of %s", o.Format, o.Compression, strings.Join(compressions, ", "))
+	}
+	if !slices.Contains(binaryEncodings, o.Binary) {
+		return fmt.Errorf("unknown binary encoding %q, expected one of %s", o.Binary, strings.Join(binaryEncodings, ", "))
+	}
+	return nil
+}
+
+func newFileWriter(path string, s *Schema, opts FileOptions) (BatchWriter, error) {
+	switch opts.Format {
+	case FormatParquet:
+		return NewParquetWriter(path, s, opts)
+	case FormatCSV, FormatJSONL:
+		return NewTextWriter(path, s, opts)
+	default:
+		return nil, fmt.Errorf("unknown format %s", opts.Format)
+	}
+}
+
+// BatchWriter stores batches of rows read by the Copier.
+type BatchWriter interface {
+	WriteBatch(batch []copiedRow) error
+	// Finish completes the output once all the rows are written
+	Finish() error
+	// Close releases the output, which is left incomplete unless it was finished
+	Close() error
+}
+
+// sqliteWriter writes batches into the single SQLite file of the copier.
+type sqliteWriter struct {
+	copier *Copier
+	target *sqliteTarget
+}
+
+// shardWriter writes every row of a batch into the shard it belongs to.
+type shardWriter struct {
+	copier *Copier
+	shards *shardSet
+}
+
+func (c *Copier) newSQLiteWriter() (BatchWriter, error) {
+	if c.shards != nil {
+		return &shardWriter{copier: c, shards: c.shards}, nil
+	}
+	target, err := newSQLiteTarget(c.sqliteDb, c.schema, c.opts.Purge)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteWriter{copier: c, target: target}, nil
+}
+
+func (w *sqliteWriter) WriteBatch(batch []copiedRow) error {
+	return w.copier.writeBatch(w.target, batch)
+}
+
+func (w *sqliteWriter) Finish() error {
+	return nil
+}
+
+func (w *sqliteWriter) Close() error {
+	w.target.Close()
+	return nil
+}
+
+func (w *shardWriter) WriteBatch(batch []copiedRow) error {
+	// Rows keep their order within every shard
+	var shards []*shard
+	shardRows := map[*shard][]copiedRow{}
+	for _, copied := range batch {
+		sh, err := w.shards.route(copied.row)
+		if err != nil {
+			return err
+		}
+		if _, found := shardRows[sh]; !found {
+			shards = append(shards, sh)
+		}
+		shardRows[sh] = append(shardRows[sh], copied)
+	}
+	for _, sh := range shards {
+		if err := w.shards.use(sh); err != nil {
+			return err
+		}
+		if err := w.copier.writeBatch(sh.target, shardRows[sh]); err != nil {
+			return fmt.Errorf("shard %s: %w", sh.path, err)
+		}
+	}
+	return w.shards.rollOver()
+}
+
+func (w *shardWriter) Finish() error {
+	return w.shards.finish()
+}
+
+// Close leaves the shards still open unfinished, like an interrupted copy leaves the single file.
+func (w *shardWriter) Close() error {
+	return nil
+}